@@ -1,15 +1,18 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"syscall"
+	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/jjuliano/runner/pkg/expect/check"
+	"github.com/jjuliano/runner/pkg/expect/process"
 	"github.com/jjuliano/runner/pkg/resolver"
 	"github.com/jjuliano/runner/pkg/runnerexec"
 	"github.com/spf13/afero"
@@ -18,11 +21,21 @@ import (
 )
 
 var (
-	cfgFile string
-	params  string
+	cfgFile      string
+	params       string
+	dryRun       bool
+	updateGolden bool
 )
 
-func initConfig(logger *log.Logger) {
+// requiresConfig is the annotation of the commands that need runner.yml.
+const requiresConfig = "requires_config"
+
+// stopGracePeriod is how long steps get to exit after SIGTERM when the runner
+// is interrupted, before they are killed.
+const stopGracePeriod = 5 * time.Second
+
+// initConfig reads runner.yml and reports whether it was found.
+func initConfig(logger *log.Logger) bool {
 	logger.Debug("Initializing configuration...")
 
 	viper.SetConfigName("runner")
@@ -30,13 +43,14 @@ func initConfig(logger *log.Logger) {
 	viper.AutomaticEnv()
 
 	if err := viper.ReadInConfig(); err != nil {
-		fmt.Println("Workflow file 'runner.yml' not found in the current directory.")
-		os.Exit(1)
+		logger.Debugf("Configuration not loaded: %v", err)
+		return false
 	}
 
 	if params != "" {
 		setRunnerParams(params)
 	}
+	return true
 }
 
 func setRunnerParams(params string) {
@@ -62,41 +76,39 @@ func createWorkDir() string {
 	return tmpDir
 }
 
+// writeEnvToFile creates the $RUNNER_ENV file steps export variables through.
+// It starts empty, steps do not see the runner environment through it.
 func writeEnvToFile(envFilePath string) error {
 	envFile, err := os.Create(envFilePath)
 	if err != nil {
 		return fmt.Errorf("error creating env file: %w", err)
 	}
-	envFile.Sync()
 	defer envFile.Close()
 
-	if err = os.Setenv("RUNNER_ENV", envFilePath); err != nil {
-		return err
-	}
-
-	for _, env := range os.Environ() {
-		keyValue := strings.SplitN(env, "=", 2)
-		key, value := keyValue[0], keyValue[1]
-
-		if strings.ContainsAny(value, " \t\n\r\"'") {
-			value = strconv.Quote(value)
-		}
-
-		if _, err := envFile.WriteString(fmt.Sprintf("%s=%s\n", key, value)); err != nil {
-			return err
-		}
-	}
-	return nil
+	return os.Setenv("RUNNER_ENV", envFilePath)
 }
 
-func createRootCmd(dr *resolver.DependencyResolver) *cobra.Command {
+func createRootCmd(dr *resolver.DependencyResolver, hasConfig bool) *cobra.Command {
 	rootCmd := &cobra.Command{
 		Use:   "runner",
 		Short: "a graph-based orchestrator",
 	}
 	rootCmd.PersistentFlags().StringVar(&params, "params", "", "extra parameters, semi-colon separated")
+	rootCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "print the commands instead of executing them")
+	rootCmd.PersistentFlags().BoolVar(&updateGolden, "update-golden", false, "rewrite the golden files of GOLDEN: checks with the output")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if !hasConfig && cmd.Annotations[requiresConfig] != "" {
+			fmt.Println("Workflow file 'runner.yml' not found in the current directory.")
+			os.Exit(1)
+		}
+		if dryRun {
+			dr.Executor = runnerexec.DryRunExecutor{}
+		}
+		check.SetUpdateGolden(updateGolden)
+	}
 
 	addCommands(rootCmd, dr)
+	addCheckCommand(rootCmd, dr)
 
 	return rootCmd
 }
@@ -115,14 +127,16 @@ func addCommands(rootCmd *cobra.Command, dr *resolver.DependencyResolver) {
 		{"tree", "Show dependency tree of the given resources", func(dr *resolver.DependencyResolver, args []string) error { return dr.HandleTreeCommand(args) }},
 		{"tree-list", "Show dependency tree list of the given resources", func(dr *resolver.DependencyResolver, args []string) error { return dr.HandleTreeListCommand(args) }},
 		{"index", "List all resource entries", func(dr *resolver.DependencyResolver, _ []string) error { return dr.HandleIndexCommand() }}, // Ignoring args here
+		{"doctor", "Evaluate the checks of the given resources without running them", func(dr *resolver.DependencyResolver, args []string) error { return dr.HandleDoctorCommand(args) }},
 		{"run", "Run the commands for the given resources", func(dr *resolver.DependencyResolver, args []string) error { return dr.HandleRunCommand(args) }},
 	}
 
 	for _, cmd := range commands {
 		cmd := cmd // Capture the loop variable
 		rootCmd.AddCommand(&cobra.Command{
-			Use:   cmd.use,
-			Short: cmd.shortDesc,
+			Use:         cmd.use,
+			Short:       cmd.shortDesc,
+			Annotations: map[string]string{requiresConfig: "true"},
 			RunE: func(c *cobra.Command, args []string) error {
 				return cmd.handler(dr, args)
 			},
@@ -130,6 +144,28 @@ func addCommands(rootCmd *cobra.Command, dr *resolver.DependencyResolver) {
 	}
 }
 
+// addCheckCommand adds `runner check`, which evaluates check expressions
+// outside of any workflow and does not need runner.yml.
+func addCheckCommand(rootCmd *cobra.Command, dr *resolver.DependencyResolver) {
+	var (
+		timeout    time.Duration
+		jsonOutput bool
+	)
+	checkCmd := &cobra.Command{
+		Use:   "check [expressions...]",
+		Short: "Evaluate check expressions, i.e. 'CMD:helm' '@TCP:localhost:5432'",
+		// The results are the output, scripts should only see them and the exit status
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(c *cobra.Command, args []string) error {
+			return dr.HandleCheckCommand(args, timeout, jsonOutput)
+		},
+	}
+	checkCmd.Flags().DurationVar(&timeout, "timeout", 0, "how long each check and persistent check may take")
+	checkCmd.Flags().BoolVar(&jsonOutput, "json", false, "print the results as JSON")
+	rootCmd.AddCommand(checkCmd)
+}
+
 func handleCommand(fn func([]string) error, args []string) {
 	if err := fn(args); err != nil {
 		resolver.LogErrorExit("Command execution failed", err)
@@ -139,7 +175,7 @@ func handleCommand(fn func([]string) error, args []string) {
 func main() {
 	logger := initLogger()
 
-	initConfig(logger)
+	hasConfig := initConfig(logger)
 
 	workDir := createWorkDir()
 	defer func() {
@@ -155,20 +191,23 @@ func main() {
 		logger.Fatalf("Failed to write environment to file: %s - %v", envFilePath, err)
 	}
 
-	if err := resolver.SourceEnvFile(envFilePath); err != nil {
-		logger.Fatalf("Failed to source environment file: %s - %v", envFilePath, err)
-	}
-
 	session := createShellSession(logger)
 	defer session.Close()
 
 	dependencyResolver := createDependencyResolver(logger, workDir, session)
 
-	loadResourceFiles(dependencyResolver)
+	if hasConfig {
+		loadResourceFiles(dependencyResolver)
+	}
+	loadRemoteSettings(dependencyResolver)
+	loadEnvSettings(dependencyResolver)
+	loadCheckSettings()
 
-	rootCmd := createRootCmd(dependencyResolver)
+	rootCmd := createRootCmd(dependencyResolver, hasConfig)
 	if err := rootCmd.Execute(); err != nil {
-		resolver.PrintMessage("%v\n", err)
+		if !errors.Is(err, resolver.ErrChecksFailed) {
+			resolver.PrintMessage("%v\n", err)
+		}
 		os.Exit(1)
 	}
 }
@@ -180,10 +219,21 @@ func signalCleanup(logger *log.Logger, workDir string) {
 	go func() {
 		sig := <-sigs
 		logger.Infof("Received signal: %v, cleaning up...", sig)
-		os.Exit(0)
+		// Steps run in process groups of their own and do not see the signal
+		runnerexec.StopProcessGroups(stopGracePeriod)
+		os.Exit(signalExitCode(sig))
 	}()
 }
 
+// signalExitCode is the exit status of a runner stopped by sig, 128 plus the
+// signal number as shells report it.
+func signalExitCode(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
+
 func createShellSession(logger *log.Logger) *runnerexec.ShellSession {
 	session, err := runnerexec.NewShellSession()
 	if err != nil {
@@ -212,3 +262,39 @@ func loadResourceFiles(dr *resolver.DependencyResolver) {
 		}
 	}
 }
+
+func loadRemoteSettings(dr *resolver.DependencyResolver) {
+	for group, hosts := range viper.GetStringMapStringSlice("inventory") {
+		dr.Inventory[group] = hosts
+	}
+
+	if err := viper.UnmarshalKey("ssh", &dr.SSHConfig); err != nil {
+		resolver.LogErrorExit("Error loading ssh settings", err)
+	}
+}
+
+func loadEnvSettings(dr *resolver.DependencyResolver) {
+	dr.EnvMode = viper.GetString("env_mode")
+	dr.EnvPassthrough = viper.GetStringSlice("env_passthrough")
+	dr.Dotenv = viper.GetStringSlice("dotenv")
+
+	process.SetStrict(viper.GetBool("strict_vars"))
+
+	resolver.SetSecretPatterns(viper.GetStringSlice("secrets"))
+	resolver.AddSecretEnv(os.Environ())
+}
+
+func loadCheckSettings() {
+	policy := check.DefaultRetryPolicy()
+	if err := viper.UnmarshalKey("checks", &policy); err != nil {
+		resolver.LogErrorExit("Error loading check settings", err)
+	}
+	check.SetDefaultRetryPolicy(policy)
+	if viper.IsSet("checks.concurrency") {
+		check.SetConcurrency(viper.GetInt("checks.concurrency"))
+	}
+
+	check.Logf = func(format string, args ...interface{}) {
+		resolver.LogDebug(fmt.Sprintf(format, args...))
+	}
+}
@@ -9,11 +9,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/jjuliano/runner/pkg/resolver"
 
 	"github.com/charmbracelet/log"
+	"github.com/jjuliano/runner/pkg/expect/check"
 	"github.com/jjuliano/runner/pkg/runnerexec"
 	"github.com/spf13/afero"
 	"github.com/spf13/viper"
@@ -142,7 +144,7 @@ workflows:
 
 func TestDependsCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"depends", "res1"}
 	rootCmd.SetArgs(args)
@@ -162,7 +164,7 @@ func TestDependsCommand(t *testing.T) {
 
 func TestRDependsCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"rdepends", "res3"}
 	rootCmd.SetArgs(args)
@@ -182,7 +184,7 @@ func TestRDependsCommand(t *testing.T) {
 
 func TestShowCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"show", "res1"}
 	rootCmd.SetArgs(args)
@@ -202,7 +204,7 @@ func TestShowCommand(t *testing.T) {
 
 func TestSearchCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"search", "Id 1"}
 	rootCmd.SetArgs(args)
@@ -222,7 +224,7 @@ func TestSearchCommand(t *testing.T) {
 
 func TestCategoryCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"category", "cat3"}
 	rootCmd.SetArgs(args)
@@ -242,7 +244,7 @@ func TestCategoryCommand(t *testing.T) {
 
 func TestTreeCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"tree", "res1"}
 	rootCmd.SetArgs(args)
@@ -262,7 +264,7 @@ func TestTreeCommand(t *testing.T) {
 
 func TestTreeListCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"tree-list", "res1"}
 	rootCmd.SetArgs(args)
@@ -282,7 +284,7 @@ func TestTreeListCommand(t *testing.T) {
 
 func TestDependsCommand_CircularDependency(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"depends", "res1"}
 	rootCmd.SetArgs(args)
@@ -302,7 +304,7 @@ func TestDependsCommand_CircularDependency(t *testing.T) {
 
 func TestIndexCommand(t *testing.T) {
 	resolver := setupTestResolver(initTestConfig(t))
-	rootCmd := createRootCmd(resolver)
+	rootCmd := createRootCmd(resolver, true)
 
 	args := []string{"index"}
 	rootCmd.SetArgs(args)
@@ -356,3 +358,56 @@ func TestIndexCommand(t *testing.T) {
 		t.Errorf("Expected output:\n%s\nGot:\n%s", expectedOutput, output)
 	}
 }
+
+func TestCheckCommandWithoutConfig(t *testing.T) {
+	dr, err := resolver.NewGraphResolver(afero.NewMemMapFs(), log.New(nil), t.TempDir(), runnerexec.LocalExecutor{})
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+	rootCmd := createRootCmd(dr, false)
+
+	rootCmd.SetArgs([]string{"check", "CMD:sh", "!CMD:nonexistentcmd"})
+	output := captureOutput(func() {
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to execute command: %v", err)
+		}
+	})
+
+	expectedOutput := "[passed] CMD:sh\n[passed] !CMD:nonexistentcmd\n"
+	if output != expectedOutput {
+		t.Errorf("Expected output:\n%s\nGot:\n%s", expectedOutput, output)
+	}
+}
+
+func TestCheckCommandUpdatesGolden(t *testing.T) {
+	dr, err := resolver.NewGraphResolver(afero.NewMemMapFs(), log.New(nil), t.TempDir(), runnerexec.LocalExecutor{})
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+	defer check.SetUpdateGolden(false)
+
+	dir := t.TempDir()
+	produced, golden := filepath.Join(dir, "produced.txt"), filepath.Join(dir, "expected.txt")
+	if err := os.WriteFile(produced, []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rootCmd := createRootCmd(dr, false)
+	rootCmd.SetArgs([]string{"check", "--update-golden", "GOLDEN[file=" + produced + "]:" + golden})
+	captureOutput(func() {
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Failed to execute command: %v", err)
+		}
+	})
+	if data, err := os.ReadFile(golden); err != nil || string(data) != "v1\n" {
+		t.Errorf("Expected the golden file to be written, got %q, %v", data, err)
+	}
+}
+
+func TestSignalExitCode(t *testing.T) {
+	for sig, expected := range map[os.Signal]int{syscall.SIGINT: 130, syscall.SIGTERM: 143} {
+		if code := signalExitCode(sig); code != expected {
+			t.Errorf("%v: expected exit status %d, got %d", sig, expected, code)
+		}
+	}
+}
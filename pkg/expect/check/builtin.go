@@ -0,0 +1,177 @@
+package check
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+	"gopkg.in/yaml.v2"
+)
+
+func init() {
+	for _, b := range []*builtin{
+		{name: "CMD", description: "checks if a command is available in $PATH, optionally with a version constraint", options: []string{"version_cmd"}, parse: parseCommand},
+		{name: "EXEC", description: "runs a command in the step shell and checks its exit status and output", options: execOptions, effects: true, parse: parseExec},
+		{name: "ENV", description: "checks if an environment variable is set, optionally with a value, pattern or number", once: true, parse: parseEnv},
+		{name: "FILE", description: "checks if a file exists, optionally with the given contents, checksum, size, mode, owner or age", options: fileOptions, parse: parseFile},
+		{name: "DIR", description: "checks if a directory exists", parse: parseDir},
+		{name: "URL", description: "checks if a HEAD request to a URL returns 200", options: []string{"request_timeout"}, parse: parseURL},
+		{name: "GIT", description: "checks the state of a git repository: clean, branch, tag, contains, pushed or changed", options: gitOptions, parse: parseGit},
+		{name: "PROC", description: "checks if a process with the name, or a command line matching the pattern, is running", parse: parseProc},
+		{name: "PID", description: "checks if the process of a pid file is running", parse: parsePID},
+		{name: "DISK", description: "compares the free space on the filesystem of a path, i.e. DISK:/var/lib/docker>=20GB", parse: parseDisk},
+		{name: "MEM", description: "compares the available memory, i.e. MEM>=8GB", parse: parseMem},
+		{name: "LOAD", description: "compares the load average, i.e. LOAD<4", options: []string{"period"}, parse: parseLoad},
+		dialChecker("TCP", "tcp", "TCP address", "checks if a host:port accepts TCP connections"),
+		dialChecker("SOCK", "unix", "socket", "checks if a Unix socket accepts connections"),
+		{name: "TEXT", description: "checks if the output contains the text", options: []string{"case_sensitive"}, output: true, parse: parseText},
+		{name: "LINE", description: "checks if a line of the step output equals the text", options: []string{"case_sensitive"}, output: true, parse: parseLine},
+		{name: "LINES", description: "compares the number of lines of the step output", output: true, parse: parseLineCount},
+		{name: "RE", description: "matches the step output against a regular expression", output: true, effects: true, parse: parseRegex},
+		{name: "GOLDEN", description: "compares the step output, or the file option, with a golden file", options: []string{"file"}, once: true, output: true, effects: true, parse: parseGolden},
+		documentChecker("JSON", json.Unmarshal),
+		documentChecker("YAML", yaml.Unmarshal),
+	} {
+		mustRegister(b)
+	}
+}
+
+// addDefaultProtocol ensures the URL has a protocol. If missing, it adds "http://"
+func addDefaultProtocol(url string) string {
+	if !strings.Contains(url, "://") {
+		return "http://" + url
+	}
+	return url
+}
+
+// parseCommand builds the CMD: condition. `CMD:go>=1.22` also runs a version
+// probe of the command, or the version_cmd option, and checks the constraints.
+func parseCommand(arg string, options map[string]string) (Condition, error) {
+	cmd, constraints, err := parseVersionConstraints(arg)
+	if err != nil {
+		return nil, err
+	}
+	probe, hasProbe := options["version_cmd"]
+	if hasProbe && constraints == nil {
+		return nil, fmt.Errorf("option 'version_cmd' requires a version constraint, i.e. CMD:%s>=1.0", cmd)
+	}
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		var path string
+		var err error
+		if scope.Remote != nil {
+			var found bool
+			found, path, err = scope.runRemote("command -v " + runnerexec.ShellQuote(cmd))
+			if err != nil {
+				return err
+			}
+			path = strings.TrimSpace(path)
+			if !found {
+				err = fmt.Errorf("%s: command not found", cmd)
+			}
+		} else {
+			pathEnv, _ := scope.LookupEnv("PATH")
+			path, err = runnerexec.WhichPath(cmd, pathEnv)
+		}
+		if constraints != nil && err == nil {
+			return checkVersion(scope, cmd, probe, constraints, negate)
+		}
+		if negate {
+			if err == nil {
+				return fmt.Errorf("unexpected executable path '%s' exists", path)
+			}
+		} else {
+			if err != nil {
+				return fmt.Errorf("expected executable path '%s' does not exist", cmd)
+			}
+		}
+		return nil
+	}), nil
+}
+
+// checkVersion verifies the version of an installed command against the constraints.
+func checkVersion(scope *Scope, cmd, probe string, constraints versionConstraints, negate bool) error {
+	version, err := probeVersion(scope, cmd, probe)
+	if err != nil {
+		if negate && !errors.Is(err, runnerexec.ErrDryRun) {
+			return nil
+		}
+		return fmt.Errorf("command '%s' has no usable version: %w", cmd, err)
+	}
+
+	satisfied := constraints.satisfiedBy(version)
+	if negate && satisfied {
+		return fmt.Errorf("unexpected command '%s' version %s satisfies %s", cmd, formatVersion(version), constraints)
+	}
+	if !negate && !satisfied {
+		return fmt.Errorf("command '%s' version %s does not satisfy %s", cmd, formatVersion(version), constraints)
+	}
+	return nil
+}
+
+func parseDir(dirPath string, options map[string]string) (Condition, error) {
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		if scope.Remote != nil {
+			exists, _, err := scope.runRemote("test -d " + runnerexec.ShellQuote(dirPath))
+			if err != nil {
+				return err
+			}
+			if negate && exists {
+				return fmt.Errorf("unexpected directory '%s' exists", dirPath)
+			}
+			if !negate && !exists {
+				return fmt.Errorf("expected directory '%s' does not exist", dirPath)
+			}
+			return nil
+		}
+		if negate {
+			if info, err := os.Stat(dirPath); err == nil && info.IsDir() {
+				return fmt.Errorf("unexpected directory '%s' exists", dirPath)
+			}
+		} else {
+			if info, err := os.Stat(dirPath); os.IsNotExist(err) || !info.IsDir() {
+				return fmt.Errorf("expected directory '%s' does not exist", dirPath)
+			}
+		}
+		return nil
+	}), nil
+}
+
+func parseURL(url string, options map[string]string) (Condition, error) {
+	url = addDefaultProtocol(url) // Ensure the URL has a protocol
+	timeout, err := durationOption(options, "request_timeout", defaultRequestTimeout)
+	if err != nil {
+		return nil, err
+	}
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		client := scope.Client
+		if client == nil {
+			client = http.DefaultClient
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), scope.attemptTimeout(timeout))
+		defer cancel()
+		var resp *http.Response
+		req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err == nil {
+			resp, err = client.Do(req)
+		}
+		if err == nil {
+			resp.Body.Close()
+		}
+		if negate {
+			if err == nil && resp.StatusCode == http.StatusOK {
+				return fmt.Errorf("unexpected URL '%s' is accessible", url)
+			}
+		} else {
+			if err != nil || resp.StatusCode != http.StatusOK {
+				return fmt.Errorf("expected URL '%s' is not accessible", url)
+			}
+		}
+		return nil
+	}), nil
+}
@@ -4,7 +4,6 @@ import (
 	"fmt"
 	"net/http"
 	"os"
-	"os/exec"
 	"strconv"
 	"strings"
 	"time"
@@ -13,191 +12,214 @@ import (
 	"github.com/jjuliano/runner/pkg/runnerexec"
 )
 
-// addDefaultProtocol ensures the URL has a protocol. If missing, it adds "http://"
-func addDefaultProtocol(url string) string {
-	if !strings.Contains(url, "://") {
-		return "http://" + url
-	}
-	return url
+// Scope is what expectations are evaluated against.
+type Scope struct {
+	Output string
+	// StepOutput is the output of the step alone. Output matchers such as
+	// JSON: read it, plain text expectations search Output.
+	StepOutput string
+	// HasStepOutput tells that StepOutput is known even when it is empty, for
+	// a step that printed nothing. Without it, an empty StepOutput falls back
+	// to Output.
+	HasStepOutput bool
+	ExitCode      int
+	Client        *http.Client
+	// Env is the environment checks see. A nil Env uses the environment of
+	// the runner process.
+	Env []string
+	// Executor runs EXEC: checks, the same way steps run. Defaults to the
+	// local shell.
+	Executor runnerexec.Executor
+	// Dir and Timeout are the working directory and timeout of EXEC: checks.
+	// GOLDEN: checks resolve relative paths against Dir.
+	Dir     string
+	Timeout time.Duration
+	// Remote, when set, evaluates CMD:, EXEC:, FILE: and DIR: checks on the
+	// host behind the executor instead of on the local machine. Network
+	// checks such as URL:, TCP: and http rules still connect from the local
+	// machine.
+	Remote runnerexec.Executor
+	// RemoteEnv is the environment passed to commands run on the remote host.
+	RemoteEnv []string
+	// Export, when set, receives the named capture groups of RE: expectations.
+	Export func(name, value string) error
+	// Once evaluates persistent conditions a single time instead of waiting for them.
+	Once bool
+	// Normalize cleans up Output and StepOutput before expectations match them.
+	Normalize Normalization
+	// Retry, when set, replaces the default retry policy of persistent
+	// conditions evaluated in the scope.
+	Retry *RetryPolicy
+
+	// done is closed when persistent conditions evaluated in the scope should stop retrying.
+	done <-chan struct{}
+	// deadline is when the persistent condition evaluated in the scope gives
+	// up, a single attempt does not wait past it.
+	deadline time.Time
 }
 
-// retryCheck attempts the check indefinitely if persistent, or returns an error for non-persistent checks.
-func retryCheck(checkFunc func() error, persistent bool) error {
-	const retryDelay = 2 * time.Second
-	attempts := 0
-	for {
-		attempts++
-		err := checkFunc()
-		if err == nil {
-			return nil
-		}
+// retryPolicy is the policy persistent conditions of the scope start from
+// before their own retry options apply.
+func (s *Scope) retryPolicy() RetryPolicy {
+	if s.Retry != nil {
+		return *s.Retry
+	}
+	return DefaultRetryPolicy()
+}
 
-		// Log the failed attempt
-		fmt.Printf("Attempt %d failed: %v\n", attempts, err)
+// attemptTimeout bounds a single attempt of a condition to limit, or to what
+// is left until the scope gives up if that is sooner.
+func (s *Scope) attemptTimeout(limit time.Duration) time.Duration {
+	if s.deadline.IsZero() {
+		return limit
+	}
+	return max(min(limit, time.Until(s.deadline)), time.Millisecond)
+}
 
-		if !persistent {
-			return err // If not persistent, return the error immediately
+// LookupEnv looks up a variable in the environment of the scope.
+func (s *Scope) LookupEnv(name string) (string, bool) {
+	if s.Env == nil {
+		return os.LookupEnv(name)
+	}
+	for i := len(s.Env) - 1; i >= 0; i-- {
+		if key, value, ok := strings.Cut(s.Env[i], "="); ok && key == name {
+			return value, true
 		}
+	}
+	return "", false
+}
 
-		// Log the retry action
-		fmt.Printf("Retrying in %s (attempt %d)\n", retryDelay, attempts)
-		time.Sleep(retryDelay) // Wait before retrying
+// runRemote runs a shell command on the remote host of the scope and reports whether it succeeded.
+func (s *Scope) runRemote(command string) (bool, string, error) {
+	result := <-runnerexec.Execute(s.Remote, runnerexec.Command{Exec: command, Env: s.RemoteEnv}, nil)
+	if result.ExitCode > 0 {
+		return false, result.Output, nil
+	}
+	if result.Err != nil {
+		return false, result.Output, result.Err
 	}
+	return true, result.Output, nil
 }
 
 // CheckExpectations verifies if the output or exit code matches the expectations.
 func CheckExpectations(output string, exitCode int, expectations []string, client *http.Client) error {
-	for _, exp := range expectations {
-		isNegation := strings.HasPrefix(exp, "!")
-		persistent := strings.HasPrefix(exp, "@") || strings.HasPrefix(exp, "!@")
-		expectation := strings.TrimPrefix(strings.TrimPrefix(exp, "@"), "!@")
-		expectation = strings.TrimPrefix(expectation, "!")
-		expectation = process.ReplaceVars(expectation)
-
-		// Define the check function as a closure
-		checkFunc := func() error {
-			// Check if the expectation is a command to execute
-			if strings.HasPrefix(expectation, "CMD:") {
-				cmd := strings.TrimPrefix(expectation, "CMD:")
-				path, err := runnerexec.Which(cmd)
-				if isNegation {
-					if err == nil {
-						return fmt.Errorf("unexpected executable path '%s' exists", path)
-					}
-				} else {
-					if err != nil {
-						return fmt.Errorf("expected executable path '%s' does not exist", cmd)
-					}
-				}
-				return nil
-			}
-
-			// Check if the expectation is a command to execute and verify its exit status
-			if strings.HasPrefix(expectation, "EXEC:") {
-				cmdStr := strings.TrimPrefix(expectation, "EXEC:")
-				cmdParts := strings.Fields(cmdStr)
-				if len(cmdParts) == 0 {
-					return fmt.Errorf("invalid EXEC command")
-				}
-
-				cmd := exec.Command(cmdParts[0], cmdParts[1:]...)
-				output, err := cmd.CombinedOutput()
-				if isNegation {
-					if err == nil {
-						return fmt.Errorf("unexpected command '%s' ran successfully: %s", cmdStr, output)
-					}
-				} else {
-					if err != nil {
-						return fmt.Errorf("command '%s' failed: %v, output: %s", cmdStr, err, output)
-					}
-				}
-				return nil
-			}
+	return Evaluate(&Scope{Output: output, ExitCode: exitCode, Client: client}, expectations)
+}
 
-			// Check if the expectation is an exit code (number)
-			if expectNum, err := strconv.Atoi(expectation); err == nil {
-				if isNegation {
-					if exitCode == expectNum {
-						return fmt.Errorf("unexpected exit status '%d'", exitCode)
-					}
-				} else {
-					if exitCode != expectNum {
-						return fmt.Errorf("expected exit status '%d' but got '%d'", expectNum, exitCode)
-					}
-				}
-				return nil
-			}
+// EvaluateRules verifies rules as they are written in YAML: expectation
+// strings, exit statuses, structured checks such as `http:`, and `all:`,
+// `any:` and `none:` groups of rules.
+func EvaluateRules(scope *Scope, rules []interface{}) error {
+	return evaluateAll(scope, len(rules), listConcurrency(allIndependent(rules)), func(scope *Scope, i int) error {
+		return evaluateRule(scope, rules[i])
+	})
+}
 
-			// Check if the expectation is an environment variable (without persistence)
-			if strings.HasPrefix(expectation, "ENV:") {
-				envVar := strings.TrimPrefix(expectation, "ENV:")
-				_, exists := os.LookupEnv(envVar)
-				if isNegation {
-					if exists {
-						return fmt.Errorf("unexpected environment variable '%s' exists", envVar)
-					}
-				} else {
-					if !exists {
-						return fmt.Errorf("expected environment variable '%s' does not exist", envVar)
-					}
-				}
-				return nil
+func evaluateRule(scope *Scope, rule interface{}) error {
+	switch r := rule.(type) {
+	case string:
+		return Evaluate(scope, []string{r})
+	case int:
+		return Evaluate(scope, []string{strconv.Itoa(r)})
+	case map[interface{}]interface{}:
+		if len(r) != 1 {
+			return fmt.Errorf("unsupported rule: %v", rule)
+		}
+		for key, value := range r {
+			cond, name := parseModifiers(fmt.Sprint(key))
+			switch name {
+			case "http":
+				return evaluateHTTP(scope, cond, value)
+			case "all", "any", "none":
+				return evaluateGroup(scope, fmt.Sprint(key), cond, name, value).Err
 			}
+		}
+	}
+	return fmt.Errorf("unsupported rule: %v", rule)
+}
 
-			// Check if the expectation is a file
-			if strings.HasPrefix(expectation, "FILE:") {
-				filePath := strings.TrimPrefix(expectation, "FILE:")
-				if isNegation {
-					if _, err := os.Stat(filePath); err == nil {
-						return fmt.Errorf("unexpected file '%s' exists", filePath)
-					}
-				} else {
-					if _, err := os.Stat(filePath); os.IsNotExist(err) {
-						return fmt.Errorf("expected file '%s' does not exist", filePath)
-					}
-				}
-				return nil
-			}
+// Evaluate verifies the expectations against the given scope, concurrently
+// when none of them has side effects, see SetConcurrency.
+func Evaluate(scope *Scope, expectations []string) error {
+	rules := make([]interface{}, len(expectations))
+	for i, exp := range expectations {
+		rules[i] = exp
+	}
+	return evaluateAll(scope, len(expectations), listConcurrency(allIndependent(rules)), func(scope *Scope, i int) error {
+		return evaluate(scope, expectations[i])
+	})
+}
 
-			// Check if the expectation is a directory
-			if strings.HasPrefix(expectation, "DIR:") {
-				dirPath := strings.TrimPrefix(expectation, "DIR:")
-				if isNegation {
-					if info, err := os.Stat(dirPath); err == nil && info.IsDir() {
-						return fmt.Errorf("unexpected directory '%s' exists", dirPath)
-					}
-				} else {
-					if info, err := os.Stat(dirPath); os.IsNotExist(err) || !info.IsDir() {
-						return fmt.Errorf("expected directory '%s' does not exist", dirPath)
-					}
-				}
-				return nil
-			}
+// evaluate verifies a single expectation, retrying it if it is persistent.
+func evaluate(scope *Scope, exp string) error {
+	c, cond, err := parseExpectation(scope, exp)
+	if err != nil {
+		return err
+	}
+	retry, _, err := cond.splitOptions()
+	if err != nil {
+		return err
+	}
+	policy, err := scope.retryPolicy().withOptions(retry)
+	if err != nil {
+		return err
+	}
 
-			// Check if the expectation is a URL
-			if strings.HasPrefix(expectation, "URL:") {
-				url := strings.TrimPrefix(expectation, "URL:")
-				url = addDefaultProtocol(url) // Ensure the URL has a protocol
-				resp, err := client.Head(url)
-				if isNegation {
-					if err == nil && resp.StatusCode == http.StatusOK {
-						return fmt.Errorf("unexpected URL '%s' is accessible", url)
-					}
-				} else {
-					if err != nil || resp.StatusCode != http.StatusOK {
-						return fmt.Errorf("expected URL '%s' is not accessible", url)
-					}
-				}
-				return nil
-			}
+	persistent := cond.persistent && !scope.Once && (cond.checker == nil || retries(cond.checker))
+	if persistent && policy.Timeout > 0 {
+		attemptScope := *scope
+		attemptScope.deadline = time.Now().Add(policy.Timeout)
+		scope = &attemptScope
+	}
+	return retryCheck(func() error { return c.Evaluate(scope, cond.negate) }, persistent, policy, scope.done)
+}
 
-			// Default string expectation check
-			if isNegation {
-				if strings.Contains(strings.ToLower(output), strings.ToLower(expectation)) {
-					return fmt.Errorf("unexpected output: found '%s'", expectation)
-				}
-			} else {
-				if !strings.Contains(strings.ToLower(output), strings.ToLower(expectation)) {
-					return fmt.Errorf("expected '%s' not found in output", expectation)
-				}
-			}
+// parseExpectation expands the variables of an expectation and parses it
+// with the checker of its prefix. Expectations without a known prefix
+// compare the exit status or search the output.
+func parseExpectation(scope *Scope, exp string) (Condition, condition, error) {
+	cond, rest := parseModifiers(exp)
+	if err := checkModifiers(exp, rest); err != nil {
+		return nil, cond, err
+	}
+	rest, err := process.Expand(rest, scope.LookupEnv)
+	if err != nil {
+		return nil, cond, fmt.Errorf("%s: %w", exp, err)
+	}
+	if err := cond.parseCheck(rest); err != nil {
+		return nil, cond, err
+	}
 
-			return nil
+	if cond.checker == nil {
+		if expectNum, err := strconv.Atoi(cond.arg); err == nil {
+			return exitStatusCondition(expectNum), cond, nil
 		}
+		return textCondition(cond.arg, false), cond, nil
+	}
 
-		// Skip persistent retry for environment variables
-		if strings.HasPrefix(expectation, "ENV:") {
-			err := checkFunc()
-			if err != nil {
-				return err
+	_, options, err := cond.splitOptions()
+	if err != nil {
+		return nil, cond, err
+	}
+	c, err := cond.checker.Parse(cond.arg, options)
+	if err != nil {
+		return nil, cond, err
+	}
+	return c, cond, nil
+}
+
+// exitStatusCondition compares the exit status of the step.
+func exitStatusCondition(expectNum int) Condition {
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		if negate {
+			if scope.ExitCode == expectNum {
+				return fmt.Errorf("unexpected exit status '%d'", scope.ExitCode)
 			}
 		} else {
-			// If persistent, retry the check function
-			err := retryCheck(checkFunc, persistent)
-			if err != nil {
-				return err
+			if scope.ExitCode != expectNum {
+				return fmt.Errorf("expected exit status '%d' but got '%d'", expectNum, scope.ExitCode)
 			}
 		}
-	}
-	return nil
+		return nil
+	})
 }
@@ -2,10 +2,17 @@ package check
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/expect/process"
+	"github.com/jjuliano/runner/pkg/runnerexec"
 )
 
 func TestCheckExpectations(t *testing.T) {
@@ -227,5 +234,130 @@ func TestCheckExpectations(t *testing.T) {
 		if err == nil {
 			t.Fatalf("expected error, got none")
 		}
+
+		// Defaults and required variables
+		err = CheckExpectations("deployed to staging", exitCode, []string{"${EXPAND_STAGE:-staging}"}, client)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		err = CheckExpectations(output, exitCode, []string{"TEXT:${EXPAND_STAGE:?EXPAND_STAGE is required}"}, client)
+		if err == nil || !strings.Contains(err.Error(), "EXPAND_STAGE is required") {
+			t.Fatalf("expected the required variable error, got %v", err)
+		}
+
+		// Unset variables are errors in strict mode
+		process.SetStrict(true)
+		defer process.SetStrict(false)
+		err = CheckExpectations(output, exitCode, []string{"TEXT:${EXPAND_STAGE}"}, client)
+		if err == nil || !strings.Contains(err.Error(), "variable 'EXPAND_STAGE' is not set") {
+			t.Fatalf("expected an unset variable error, got %v", err)
+		}
 	})
 }
+
+func TestEvaluateRemote(t *testing.T) {
+	// A local shell stands in for the remote host; the checks must go through it.
+	recorder := runnerexec.NewRecordingExecutor(runnerexec.LocalExecutor{})
+	scope := &Scope{Client: &http.Client{}, Remote: recorder}
+
+	dir, err := os.MkdirTemp("", "remotedir")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		expectation string
+		hasError    bool
+	}{
+		{"FILE:" + dir, false},
+		{"!FILE:/non/existent/file", false},
+		{"DIR:" + dir, false},
+		{"DIR:/non/existent/dir", true},
+		{"CMD:sh", false},
+		{"!CMD:nonexistentcmd", false},
+		{"EXEC:test -d " + dir, false},
+		{"!EXEC:test -d /non/existent/dir", false},
+	}
+
+	for _, test := range tests {
+		err := Evaluate(scope, []string{test.expectation})
+		if (err != nil) != test.hasError {
+			t.Errorf("%s: expected error %v, got %v", test.expectation, test.hasError, err)
+		}
+	}
+
+	if len(recorder.Commands()) != len(tests) {
+		t.Errorf("expected every check to run on the remote, got %d commands", len(recorder.Commands()))
+	}
+}
+
+func TestURLAttemptsAreBounded(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	tests := []string{
+		"URL[request_timeout=200ms]:" + ts.URL,
+		"@URL[timeout=200ms,request_timeout=1m]:" + ts.URL,
+	}
+
+	for _, expectation := range tests {
+		start := time.Now()
+		if err := Evaluate(&Scope{Client: &http.Client{}}, []string{expectation}); err == nil {
+			t.Errorf("%s: expected error, got none", expectation)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: expected the request to stop after about 200ms, took %s", expectation, elapsed)
+		}
+	}
+}
+
+func TestTCPAndSocketExpectations(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	socketPath := filepath.Join(t.TempDir(), "test.sock")
+	socket, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer socket.Close()
+
+	// A port that was just released is closed
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"TCP:" + listener.Addr().String(), false},
+		{"@TCP[connect_timeout=1s,attempts=2]:" + listener.Addr().String(), false},
+		{"TCP:" + closedAddr, true},
+		{"!TCP:" + closedAddr, false},
+		{"!TCP:" + listener.Addr().String(), true},
+		{"@TCP[attempts=2,interval=10ms]:" + closedAddr, true},
+		{"TCP[connect_timeout=soon]:" + listener.Addr().String(), true},
+		{"SOCK:" + socketPath, false},
+		{"SOCK:" + filepath.Join(t.TempDir(), "missing.sock"), true},
+		{"!SOCK:" + socketPath, true},
+	}
+
+	for _, tt := range tests {
+		err := CheckExpectations("", 0, []string{tt.expectation}, &http.Client{})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+}
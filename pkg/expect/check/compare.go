@@ -0,0 +1,62 @@
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// comparisonOperators are tried in order, so two character operators win over their prefixes.
+var comparisonOperators = []string{"==", "!=", ">=", "<=", ">", "<"}
+
+// splitComparison splits `left op right` at the first comparison operator.
+func splitComparison(s string) (string, string, string, bool) {
+	for i := 0; i < len(s); i++ {
+		for _, op := range comparisonOperators {
+			if strings.HasPrefix(s[i:], op) {
+				return strings.TrimSpace(s[:i]), op, strings.TrimSpace(s[i+len(op):]), true
+			}
+		}
+	}
+	return s, "", "", false
+}
+
+// compareOrdered applies the operator to the result of a three-way comparison.
+func compareOrdered(cmp int, op string) bool {
+	switch op {
+	case "==":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	}
+	return false
+}
+
+// compareNumbers compares two numbers with the operator.
+func compareNumbers(a float64, op string, b float64) bool {
+	switch {
+	case a < b:
+		return compareOrdered(-1, op)
+	case a > b:
+		return compareOrdered(1, op)
+	default:
+		return compareOrdered(0, op)
+	}
+}
+
+// parseNumber parses a decimal number written in a condition.
+func parseNumber(s string) (float64, error) {
+	n, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a number", s)
+	}
+	return n, nil
+}
@@ -0,0 +1,171 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+var (
+	concurrencyMu sync.RWMutex
+	concurrency   int
+)
+
+// errCanceled is returned by persistent conditions that were stopped, because
+// an earlier condition of the same list failed.
+var errCanceled = errors.New("canceled")
+
+// Concurrency returns how many conditions of a list are evaluated at the same
+// time, or 0 when it depends on the list, see SetConcurrency.
+func Concurrency() int {
+	concurrencyMu.RLock()
+	defer concurrencyMu.RUnlock()
+	return concurrency
+}
+
+// SetConcurrency sets how many conditions of a list are evaluated at the
+// same time. 1 evaluates them one by one, in order. 0, the default, evaluates
+// up to GOMAXPROCS of them at the same time when none has side effects, and
+// the others one by one, so that a condition sees the side effects of an
+// earlier EXEC:, RE: or GOLDEN:.
+func SetConcurrency(n int) {
+	concurrencyMu.Lock()
+	defer concurrencyMu.Unlock()
+	concurrency = max(n, 0)
+}
+
+// listConcurrency is how many conditions of a list are evaluated at the same time.
+func listConcurrency(independent bool) int {
+	if n := Concurrency(); n > 0 {
+		return n
+	}
+	if independent {
+		return runtime.GOMAXPROCS(0)
+	}
+	return 1
+}
+
+// independent reports whether a rule can be evaluated at the same time as
+// the others of its list: it does not run commands, write files or export
+// variables that another rule could depend on. Checkers outside the builtins
+// are not known not to.
+func independent(rule interface{}) bool {
+	switch r := rule.(type) {
+	case string:
+		_, rest := parseModifiers(r)
+		end := strings.IndexAny(rest, checkNameEnd)
+		if end == -1 {
+			return true
+		}
+		checker, ok := Lookup(rest[:end])
+		if !ok {
+			return true
+		}
+		b, ok := checker.(*builtin)
+		return ok && !b.effects
+	case int:
+		return true
+	case map[interface{}]interface{}:
+		for key, value := range r {
+			_, name := parseModifiers(fmt.Sprint(key))
+			if name == "http" {
+				return true
+			}
+			if rules, ok := value.([]interface{}); ok && contains(groupKinds, name) {
+				return allIndependent(rules)
+			}
+		}
+	}
+	return false
+}
+
+// allIndependent reports whether every rule of a list is independent.
+func allIndependent(rules []interface{}) bool {
+	for _, rule := range rules {
+		if !independent(rule) {
+			return false
+		}
+	}
+	return true
+}
+
+// evaluateAll evaluates the n conditions of a list, at most limit at a
+// time and started in list order. It returns the error of the first condition
+// in list order that failed, so reports do not depend on timing. A failure
+// cancels the persistent conditions after it, since they cannot change the outcome.
+func evaluateAll(scope *Scope, n, limit int, evaluate func(scope *Scope, i int) error) error {
+	if n <= 1 || limit == 1 {
+		for i := 0; i < n; i++ {
+			if err := evaluate(scope, i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	errs := make([]error, n)
+	dones := make([]chan struct{}, n)
+	for i := range dones {
+		dones[i] = make(chan struct{})
+	}
+
+	var mu sync.Mutex
+	canceledFrom := n
+	cancel := func(from int) {
+		mu.Lock()
+		defer mu.Unlock()
+		for ; from < canceledFrom; canceledFrom-- {
+			close(dones[canceledFrom-1])
+		}
+	}
+	canceled := func(i int) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return i >= canceledFrom
+	}
+
+	stop := make(chan struct{})
+	defer close(stop)
+	if scope.done != nil {
+		go func() {
+			select {
+			case <-scope.done:
+				cancel(0)
+			case <-stop:
+			}
+		}()
+	}
+
+	sem := make(chan struct{}, limit)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		if canceled(i) {
+			<-sem
+			errs[i] = errCanceled
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			itemScope := *scope
+			itemScope.done = dones[i]
+			if errs[i] = evaluate(&itemScope, i); errs[i] != nil {
+				cancel(i + 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
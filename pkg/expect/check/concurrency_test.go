@@ -0,0 +1,136 @@
+package check
+
+import (
+	"errors"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var running, maxRunning, evaluated int32
+
+// WAIT:duration[:message] sleeps, then fails with the message if there is one.
+func init() {
+	mustRegister(&builtin{name: "WAIT", description: "test check", parse: func(arg string, options map[string]string) (Condition, error) {
+		wait, message, _ := strings.Cut(arg, ":")
+		d, err := time.ParseDuration(wait)
+		if err != nil {
+			return nil, err
+		}
+		return ConditionFunc(func(scope *Scope, negate bool) error {
+			atomic.AddInt32(&evaluated, 1)
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			time.Sleep(d)
+			if message != "" {
+				return errors.New(message)
+			}
+			return nil
+		}), nil
+	}})
+}
+
+func TestDefaultConcurrency(t *testing.T) {
+	if Concurrency() != 0 {
+		t.Fatalf("expected the concurrency to depend on the list by default, got %d", Concurrency())
+	}
+
+	marker := filepath.Join(t.TempDir(), "done")
+	if err := Evaluate(&Scope{}, []string{"EXEC:sleep 0.1; touch " + marker, "FILE:" + marker}); err != nil {
+		t.Errorf("expected a condition to see the side effects of the one before it, got %v", err)
+	}
+
+	if runtime.GOMAXPROCS(0) > 1 {
+		start := time.Now()
+		if err := Evaluate(&Scope{}, []string{"WAIT:100ms", "WAIT:100ms", "WAIT:100ms"}); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+			t.Errorf("expected independent checks to run concurrently, took %s", elapsed)
+		}
+	}
+
+	tests := []struct {
+		rule        interface{}
+		independent bool
+	}{
+		{"@URL:localhost:8080", true},
+		{"!ENV:HOME", true},
+		{"plain text", true},
+		{0, true},
+		{map[interface{}]interface{}{"http": map[interface{}]interface{}{"url": "localhost"}}, true},
+		{map[interface{}]interface{}{"any": []interface{}{"FILE:/tmp", "DIR:/tmp"}}, true},
+		{"EXEC:true", false},
+		{"RE:(?P<version>.+)", false},
+		{"GOLDEN:expected.txt", false},
+		{map[interface{}]interface{}{"all": []interface{}{"FILE:/tmp", "!EXEC:false"}}, false},
+	}
+	for _, tt := range tests {
+		if independent(tt.rule) != tt.independent {
+			t.Errorf("%v: expected independent %v", tt.rule, tt.independent)
+		}
+	}
+}
+
+func TestConcurrentEvaluation(t *testing.T) {
+	defer SetConcurrency(Concurrency())
+	SetConcurrency(4)
+
+	start := time.Now()
+	if err := Evaluate(&Scope{}, []string{"WAIT:100ms", "WAIT:100ms", "WAIT:100ms"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("expected the checks to run concurrently, took %s", elapsed)
+	}
+
+	err := Evaluate(&Scope{}, []string{"WAIT:0s", "WAIT:80ms:first", "WAIT:0s:second"})
+	if err == nil || err.Error() != "first" {
+		t.Errorf("expected the first failure in list order, got %v", err)
+	}
+
+	err = EvaluateRules(&Scope{}, []interface{}{"WAIT:50ms:first", map[interface{}]interface{}{"any": []interface{}{"WAIT:0s:second"}}})
+	if err == nil || err.Error() != "first" {
+		t.Errorf("expected the first failure in list order, got %v", err)
+	}
+
+	start = time.Now()
+	err = Evaluate(&Scope{}, []string{"WAIT:0s:failed", "@WAIT[timeout=10s,interval=10ms]:0s:not ready"})
+	if err == nil || err.Error() != "failed" {
+		t.Errorf("expected the first failure, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected the persistent check to be canceled, took %s", elapsed)
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	defer SetConcurrency(Concurrency())
+
+	SetConcurrency(2)
+	atomic.StoreInt32(&maxRunning, 0)
+	if err := Evaluate(&Scope{}, []string{"WAIT:20ms", "WAIT:20ms", "WAIT:20ms", "WAIT:20ms", "WAIT:20ms"}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if m := atomic.LoadInt32(&maxRunning); m != 2 {
+		t.Errorf("expected at most 2 checks at a time, got %d", m)
+	}
+
+	SetConcurrency(1)
+	atomic.StoreInt32(&evaluated, 0)
+	if err := Evaluate(&Scope{}, []string{"WAIT:0s:failed", "WAIT:0s"}); err == nil {
+		t.Fatalf("expected an error")
+	}
+	if n := atomic.LoadInt32(&evaluated); n != 1 {
+		t.Errorf("expected checks after a failure not to be evaluated, got %d", n)
+	}
+}
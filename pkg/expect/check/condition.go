@@ -0,0 +1,184 @@
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// condition is an expectation split into its modifiers, check name, options and argument.
+type condition struct {
+	negate     bool
+	persistent bool
+	// name is the check name, empty for exit status and output expectations.
+	name    string
+	options map[string]string
+	arg     string
+	// checker handles the check, nil for exit status and output expectations.
+	checker Checker
+}
+
+// parseModifiers strips the `!`, `@` or `!@` modifiers off an expectation.
+func parseModifiers(exp string) (condition, string) {
+	var cond condition
+	switch {
+	case strings.HasPrefix(exp, "!@"):
+		cond.negate, cond.persistent = true, true
+		return cond, exp[2:]
+	case strings.HasPrefix(exp, "!"):
+		cond.negate = true
+		return cond, exp[1:]
+	case strings.HasPrefix(exp, "@"):
+		cond.persistent = true
+		return cond, exp[1:]
+	}
+	return cond, exp
+}
+
+// checkModifiers rejects a check whose modifiers are not `!`, `@` or `!@`,
+// such as `@!CMD:helm`, which would otherwise be taken as an output expectation.
+func checkModifiers(exp, rest string) error {
+	if trimmed := strings.TrimLeft(rest, "!@"); trimmed != rest && HasCheckPrefix(trimmed) {
+		return fmt.Errorf("invalid modifiers in '%s', expected !, @ or !@ before the check name", exp)
+	}
+	return nil
+}
+
+// checkNameEnd are the characters that can follow a check name. A comparison
+// operator directly after the name, as in `MEM>=8GB`, is part of the argument.
+const checkNameEnd = ":[<>="
+
+// parseCheck splits `NAME:arg`, `NAME[key=value,...]:arg` or `NAME>=limit` into the condition.
+// Anything that does not name a known check is left as an output expectation.
+func (c *condition) parseCheck(s string) error {
+	c.arg = s
+
+	end := strings.IndexAny(s, checkNameEnd)
+	if end == -1 {
+		return nil
+	}
+	checker, ok := Lookup(s[:end])
+	if !ok {
+		return nil
+	}
+	name, rest := s[:end], s[end:]
+
+	var options map[string]string
+	if strings.HasPrefix(rest, "[") {
+		closing := indexUnquoted(rest, ']')
+		if closing == -1 || !strings.HasPrefix(rest[closing+1:], ":") && !startsWithComparison(rest[closing+1:]) {
+			return nil
+		}
+		var err error
+		if options, err = parseOptions(rest[1:closing]); err != nil {
+			return fmt.Errorf("invalid options for %s check: %v", name, err)
+		}
+		rest = rest[closing+1:]
+	}
+
+	c.name, c.options, c.arg, c.checker = name, options, strings.TrimPrefix(rest, ":"), checker
+	return nil
+}
+
+// startsWithComparison reports whether s starts with a comparison operator.
+func startsWithComparison(s string) bool {
+	return s != "" && strings.ContainsRune("<>=", rune(s[0]))
+}
+
+// parseOptions parses a comma separated list of key=value pairs. Values
+// containing commas or brackets can be quoted with single or double quotes.
+func parseOptions(s string) (map[string]string, error) {
+	options := make(map[string]string)
+	for s != "" {
+		end := indexUnquoted(s, ',')
+		if end == -1 {
+			end = len(s)
+		}
+		pair := strings.TrimSpace(s[:end])
+		s = s[min(end+1, len(s)):]
+		if pair == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("option '%s' is not a key=value pair", pair)
+		}
+		value = strings.TrimSpace(value)
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		options[strings.TrimSpace(key)] = value
+	}
+	return options, nil
+}
+
+// indexUnquoted finds the first c in s that is not inside single or double quotes.
+func indexUnquoted(s string, c byte) int {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch {
+		case quote != 0:
+			if s[i] == quote {
+				quote = 0
+			}
+		case s[i] == '"' || s[i] == '\'':
+			quote = s[i]
+		case s[i] == c:
+			return i
+		}
+	}
+	return -1
+}
+
+// splitOptions separates the retry options of the condition from the options of its check.
+func (c *condition) splitOptions() (map[string]string, map[string]string, error) {
+	retry, check := make(map[string]string), make(map[string]string)
+	for key, value := range c.options {
+		if !contains(retryOptions, key) {
+			check[key] = value
+			continue
+		}
+		if !c.persistent {
+			return nil, nil, fmt.Errorf("option '%s' only applies to persistent (@) checks", key)
+		}
+		retry[key] = value
+	}
+	return retry, check, nil
+}
+
+// boolOption reads a true/false option.
+func boolOption(options map[string]string, key string) (bool, error) {
+	value, ok := options[key]
+	if !ok {
+		return false, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s '%s': %v", key, value, err)
+	}
+	return b, nil
+}
+
+// durationOption reads a duration option, which defaults to def.
+func durationOption(options map[string]string, key string, def time.Duration) (time.Duration, error) {
+	value, ok := options[key]
+	if !ok {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s '%s': %v", key, value, err)
+	}
+	return d, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package check
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		exp        string
+		negate     bool
+		persistent bool
+		name       string
+		options    map[string]string
+		arg        string
+	}{
+		{exp: "hello", arg: "hello"},
+		{exp: "!CMD:helm", negate: true, name: "CMD", arg: "helm"},
+		{exp: "@CMD:helm", persistent: true, name: "CMD", arg: "helm"},
+		{exp: "!@FILE:/tmp/file.sock", negate: true, persistent: true, name: "FILE", arg: "/tmp/file.sock"},
+		{exp: "@URL[timeout=120s, interval=5s]:localhost:3000", persistent: true, name: "URL", options: map[string]string{"timeout": "120s", "interval": "5s"}, arg: "localhost:3000"},
+		{exp: "EXEC[contains='a, b]', status=1]:echo 'a, b]'", name: "EXEC", options: map[string]string{"contains": "a, b]", "status": "1"}, arg: "echo 'a, b]'"},
+		{exp: "MEM>=8GB", name: "MEM", arg: ">=8GB"},
+		{exp: "!LOAD[period=5m]<4", negate: true, name: "LOAD", options: map[string]string{"period": "5m"}, arg: "<4"},
+		{exp: "DISK:/var/lib/docker>=20GB", name: "DISK", arg: "/var/lib/docker>=20GB"},
+		{exp: "UNKNOWN:value", arg: "UNKNOWN:value"},
+		{exp: "a<b", arg: "a<b"},
+		{exp: "URL[not an option", arg: "URL[not an option"},
+	}
+
+	for _, tt := range tests {
+		cond, rest := parseModifiers(tt.exp)
+		if err := cond.parseCheck(rest); err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.exp, err)
+		}
+		if cond.negate != tt.negate || cond.persistent != tt.persistent || cond.name != tt.name || cond.arg != tt.arg {
+			t.Errorf("%s: unexpected condition %+v", tt.exp, cond)
+		}
+		for key, value := range tt.options {
+			if cond.options[key] != value {
+				t.Errorf("%s: expected option %s=%s, got %q", tt.exp, key, value, cond.options[key])
+			}
+		}
+	}
+}
+
+func TestConditionOptionErrors(t *testing.T) {
+	for _, exp := range []string{
+		"@URL[timeout]:localhost",
+		"@URL[colour=red]:localhost",
+		"URL[timeout=5s]:localhost",
+		"@!CMD:sh",
+		"!!CMD:sh",
+	} {
+		if err := CheckExpectations("", 0, []string{exp}, &http.Client{}); err == nil {
+			t.Errorf("%s: expected error, got none", exp)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package check
+
+import (
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// defaultConnectTimeout limits a single TCP: or SOCK: connection attempt.
+	defaultConnectTimeout = 5 * time.Second
+	// defaultRequestTimeout limits a single URL: request.
+	defaultRequestTimeout = 10 * time.Second
+)
+
+// dialChecker builds the TCP: and SOCK: checkers, which verify that an address accepts connections.
+func dialChecker(name, network, kind, description string) *builtin {
+	return &builtin{
+		name:        name,
+		description: description,
+		options:     []string{"connect_timeout"},
+		parse: func(address string, options map[string]string) (Condition, error) {
+			timeout, err := durationOption(options, "connect_timeout", defaultConnectTimeout)
+			if err != nil {
+				return nil, err
+			}
+			return ConditionFunc(func(scope *Scope, negate bool) error {
+				err := dial(network, address, scope.attemptTimeout(timeout))
+				if negate {
+					if err == nil {
+						return fmt.Errorf("unexpected %s '%s' accepts connections", kind, address)
+					}
+				} else {
+					if err != nil {
+						return fmt.Errorf("expected %s '%s' is not reachable: %v", kind, address, err)
+					}
+				}
+				return nil
+			}), nil
+		},
+	}
+}
+
+// dial reports whether a connection to the address can be established.
+func dial(network, address string, timeout time.Duration) error {
+	conn, err := net.DialTimeout(network, address, timeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
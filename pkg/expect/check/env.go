@@ -0,0 +1,128 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// envNamePattern splits `NAME` off the operator and value of an ENV: condition.
+var envNamePattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_]*)(.*)$`)
+
+// envOperators are tried in order, so two character operators win over their prefixes.
+var envOperators = []string{"!empty", "~=", "==", "!=", ">=", "<=", "=", ">", "<"}
+
+// parseEnv builds the ENV: condition. `ENV:NAME` holds when the variable is
+// set, `ENV:NAME=value` when it equals the value, `ENV:NAME~=regex` when it
+// matches the pattern, `ENV:NAME!empty` when it is not empty, and
+// `ENV:NAME>=1024` when it is a number that satisfies the comparison.
+// Values are only shown in errors of numeric comparisons, since they may be secrets.
+func parseEnv(arg string, options map[string]string) (Condition, error) {
+	m := envNamePattern.FindStringSubmatch(arg)
+	if m == nil {
+		return nil, fmt.Errorf("invalid environment variable name in '%s'", arg)
+	}
+	envVar, rest := m[1], m[2]
+
+	var op string
+	for _, candidate := range envOperators {
+		if strings.HasPrefix(rest, candidate) {
+			op = candidate
+			break
+		}
+	}
+	if rest != "" && op == "" {
+		return nil, fmt.Errorf("invalid environment variable condition '%s'", arg)
+	}
+	want := rest[len(op):]
+
+	var re *regexp.Regexp
+	var number float64
+	switch op {
+	case "!empty":
+		if want != "" {
+			return nil, fmt.Errorf("invalid environment variable condition '%s'", arg)
+		}
+	case "~=":
+		var err error
+		if re, err = regexp.Compile(want); err != nil {
+			return nil, fmt.Errorf("invalid pattern '%s': %v", want, err)
+		}
+	case ">=", "<=", ">", "<":
+		var err error
+		if number, err = parseNumber(want); err != nil {
+			return nil, err
+		}
+	}
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		value, exists := scope.LookupEnv(envVar)
+		if op == "" || !exists {
+			if negate && exists {
+				return fmt.Errorf("unexpected environment variable '%s' exists", envVar)
+			}
+			if !negate && !exists {
+				return fmt.Errorf("expected environment variable '%s' does not exist", envVar)
+			}
+			return nil
+		}
+
+		holds, err := envValueHolds(value, op, want, re, number)
+		if err != nil && !negate {
+			return fmt.Errorf("environment variable '%s' is not a number: %v", envVar, err)
+		}
+		if negate == holds {
+			return envValueError(envVar, value, op, want, negate)
+		}
+		return nil
+	}), nil
+}
+
+// envValueHolds applies the operator of an ENV: condition to the value of the variable.
+func envValueHolds(value, op, want string, re *regexp.Regexp, number float64) (bool, error) {
+	switch op {
+	case "!empty":
+		return value != "", nil
+	case "~=":
+		return re.MatchString(value), nil
+	case "=", "==":
+		return value == want, nil
+	case "!=":
+		return value != want, nil
+	}
+	n, err := parseNumber(value)
+	if err != nil {
+		return false, err
+	}
+	return compareNumbers(n, op, number), nil
+}
+
+// envValueError explains why an ENV: condition failed. Only numeric
+// comparisons show the value of the variable, since it may be a secret.
+func envValueError(envVar, value, op, want string, negate bool) error {
+	if negate {
+		switch op {
+		case "!empty":
+			return fmt.Errorf("unexpected environment variable '%s' is not empty", envVar)
+		case "~=":
+			return fmt.Errorf("unexpected environment variable '%s' matches '%s'", envVar, want)
+		case "=", "==":
+			return fmt.Errorf("unexpected environment variable '%s' is '%s'", envVar, want)
+		case "!=":
+			return fmt.Errorf("unexpected environment variable '%s' is not '%s'", envVar, want)
+		}
+		return fmt.Errorf("unexpected environment variable '%s' is %s, expected not %s %s", envVar, value, op, want)
+	}
+
+	switch op {
+	case "!empty":
+		return fmt.Errorf("environment variable '%s' is empty", envVar)
+	case "~=":
+		return fmt.Errorf("environment variable '%s' does not match '%s'", envVar, want)
+	case "=", "==":
+		return fmt.Errorf("environment variable '%s' is not '%s'", envVar, want)
+	case "!=":
+		return fmt.Errorf("environment variable '%s' is '%s'", envVar, want)
+	}
+	return fmt.Errorf("environment variable '%s' is %s, expected %s %s", envVar, value, op, want)
+}
@@ -0,0 +1,64 @@
+package check
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvExpectations(t *testing.T) {
+	scope := &Scope{Env: []string{
+		"GH_TOKEN=ghp_0123456789",
+		"EMPTY_TOKEN=",
+		"STAGE=production",
+		"PORT=8080",
+		"WORKERS=four",
+	}}
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"ENV:EMPTY_TOKEN", false},
+		{"ENV:EMPTY_TOKEN!empty", true},
+		{"ENV:GH_TOKEN!empty", false},
+		{"!ENV:EMPTY_TOKEN!empty", false},
+		{"ENV:MISSING!empty", true},
+		{"!ENV:MISSING!empty", false},
+		{"ENV:STAGE=production", false},
+		{"ENV:STAGE==production", false},
+		{"ENV:STAGE=staging", true},
+		{"ENV:STAGE!=staging", false},
+		{"!ENV:STAGE=production", true},
+		{"ENV:GH_TOKEN~=^ghp_[0-9]+$", false},
+		{"ENV:GH_TOKEN~=^github_pat_", true},
+		{"ENV:PORT>=1024", false},
+		{"ENV:PORT<1024", true},
+		{"ENV:PORT==8080", false},
+		{"ENV:WORKERS>1", true},
+		{"ENV:GH_TOKEN~=[", true},
+		{"ENV:PORT>=many", true},
+		{"ENV:STAGE!production", true},
+		{"ENV:1STAGE", true},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(scope, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+}
+
+func TestEnvErrorsHideValues(t *testing.T) {
+	scope := &Scope{Env: []string{"GH_TOKEN=ghp_0123456789", "PORT=80"}}
+
+	err := Evaluate(scope, []string{"ENV:GH_TOKEN~=^github_pat_"})
+	if err == nil || strings.Contains(err.Error(), "ghp_0123456789") {
+		t.Errorf("expected an error without the value, got %v", err)
+	}
+
+	err = Evaluate(scope, []string{"ENV:PORT>=1024"})
+	if err == nil || err.Error() != "environment variable 'PORT' is 80, expected >= 1024" {
+		t.Errorf("expected the value of a numeric comparison in the error, got %v", err)
+	}
+}
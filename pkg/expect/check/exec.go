@@ -0,0 +1,104 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// execOptions are the assertions an EXEC[...] check makes about the command.
+var execOptions = []string{"status", "contains", "matches", "equals"}
+
+// parseExec builds the EXEC: condition. The command runs in a shell through
+// the executor of the scope, with the environment, working directory and
+// timeout of the step. It holds when the command exits with the expected
+// status (0 unless set) and its output passes the assertions.
+func parseExec(cmdStr string, options map[string]string) (Condition, error) {
+	if strings.TrimSpace(cmdStr) == "" {
+		return nil, fmt.Errorf("invalid EXEC command")
+	}
+
+	status := 0
+	if value, ok := options["status"]; ok {
+		var err error
+		if status, err = strconv.Atoi(value); err != nil {
+			return nil, fmt.Errorf("invalid status '%s': %v", value, err)
+		}
+	}
+
+	var re *regexp.Regexp
+	if pattern, ok := options["matches"]; ok {
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid matches pattern '%s': %v", pattern, err)
+		}
+	}
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		result := <-runnerexec.Execute(scope.executor(), runnerexec.Command{
+			Exec:    cmdStr,
+			Env:     scope.commandEnv(),
+			Dir:     scope.Dir,
+			Timeout: scope.Timeout,
+		}, nil)
+		if errors.Is(result.Err, runnerexec.ErrDryRun) {
+			return result.Err
+		}
+
+		err := execResult(result, status, options, re)
+		if negate {
+			if err == nil {
+				return fmt.Errorf("unexpected command '%s' ran successfully: %s", cmdStr, result.Output)
+			}
+		} else {
+			if err != nil {
+				return fmt.Errorf("command '%s' failed: %v, output: %s", cmdStr, err, result.Output)
+			}
+		}
+		return nil
+	}), nil
+}
+
+// execResult verifies the exit status and output of an EXEC: command.
+func execResult(result runnerexec.CommandResult, status int, options map[string]string, re *regexp.Regexp) error {
+	if result.ExitCode != status {
+		if result.Err != nil {
+			return result.Err
+		}
+		return fmt.Errorf("exit status %d", result.ExitCode)
+	}
+	if text, ok := options["contains"]; ok && !strings.Contains(result.Output, text) {
+		return fmt.Errorf("output does not contain '%s'", text)
+	}
+	if re != nil && !re.MatchString(strings.TrimSuffix(result.Output, "\n")) {
+		return fmt.Errorf("output does not match '%s'", re)
+	}
+	if text, ok := options["equals"]; ok && strings.TrimSpace(result.Output) != text {
+		return fmt.Errorf("output is not '%s'", text)
+	}
+	return nil
+}
+
+// executor is the executor EXEC: checks run with.
+func (s *Scope) executor() runnerexec.Executor {
+	switch {
+	case s.Remote != nil:
+		return s.Remote
+	case s.Executor != nil:
+		return s.Executor
+	default:
+		return runnerexec.LocalExecutor{}
+	}
+}
+
+// commandEnv is the environment of commands run by checks.
+func (s *Scope) commandEnv() []string {
+	if s.Remote != nil {
+		return s.RemoteEnv
+	}
+	return s.Env
+}
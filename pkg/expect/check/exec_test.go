@@ -0,0 +1,89 @@
+package check
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+func TestExecExpectations(t *testing.T) {
+	dir := t.TempDir()
+	scope := &Scope{
+		Env: []string{"PATH=/usr/bin:/bin", "GREETING=hello world"},
+		Dir: dir,
+	}
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"EXEC:true", false},
+		{"EXEC:false", true},
+		{"!EXEC:false", false},
+		{"EXEC:echo one two | grep -q two && test -n \"$GREETING\"", false},
+		{"EXEC:test \"$(pwd)\" = '" + dir + "'", false},
+		{"EXEC[status=3]:exit 3", false},
+		{"EXEC[status=3]:exit 0", true},
+		{"EXEC[contains=world]:echo $GREETING", false},
+		{"EXEC[contains=moon]:echo $GREETING", true},
+		{"EXEC[equals='hello world']:echo $GREETING", false},
+		{`EXEC[matches='^hel+o, w[a-z]+$']:echo "hello, world"`, false},
+		{"EXEC[matches=^bye]:echo $GREETING", true},
+		{"EXEC[matches=(]:echo", true},
+		{"EXEC[status=ok]:true", true},
+		{"EXEC[verbose=true]:true", true},
+		{"EXEC: ", true},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(scope, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+}
+
+func TestExecUsesScopeExecutorAndTimeout(t *testing.T) {
+	recorder := runnerexec.NewRecordingExecutor(runnerexec.LocalExecutor{})
+	scope := &Scope{Executor: recorder, Env: []string{"A=1"}, Dir: filepath.Join(t.TempDir()), Timeout: 100 * time.Millisecond}
+
+	start := time.Now()
+	if err := Evaluate(scope, []string{"EXEC:sleep 30"}); err == nil {
+		t.Errorf("expected timeout error, got none")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("expected the check to stop at the timeout")
+	}
+
+	commands := recorder.Commands()
+	if len(commands) != 1 || commands[0].Exec != "sleep 30" || commands[0].Dir != scope.Dir || commands[0].Timeout != scope.Timeout {
+		t.Errorf("unexpected recorded commands: %+v", commands)
+	}
+}
+
+func TestDryRunCommandsAreSkipped(t *testing.T) {
+	scope := &Scope{Executor: runnerexec.DryRunExecutor{}}
+
+	tests := []interface{}{
+		"EXEC:true",
+		"!EXEC:false",
+		"CMD:sh>=1.0",
+		"!CMD[version_cmd='echo 1.0']:sh>=99",
+		"GIT:clean",
+		map[interface{}]interface{}{"any": []interface{}{"EXEC:true", "FILE:/does/not/exist"}},
+	}
+
+	for _, rule := range tests {
+		result := EvaluateResult(scope, rule)
+		if !result.Skipped || !errors.Is(result.Err, runnerexec.ErrDryRun) {
+			t.Errorf("%v: expected skipped with %v, got skipped %v with %v", rule, runnerexec.ErrDryRun, result.Skipped, result.Err)
+		}
+	}
+
+	if result := EvaluateResult(scope, "FILE:/does/not/exist"); result.Skipped || result.Err == nil {
+		t.Errorf("expected checks without commands to be evaluated, got %+v", result)
+	}
+}
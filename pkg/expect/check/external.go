@@ -0,0 +1,123 @@
+package check
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// externalPrefix is the prefix of the executables that provide external checks.
+const externalPrefix = "runner-check-"
+
+// ExternalRequest is written as JSON to the stdin of an external check.
+type ExternalRequest struct {
+	// Name is the check name as written in the condition, i.e. KAFKA in `KAFKA:topic`.
+	Name string `json:"name"`
+	// Argument is the part of the condition after the colon.
+	Argument string            `json:"argument"`
+	Options  map[string]string `json:"options,omitempty"`
+	// Output is the whole output, StepOutput the output of the step alone.
+	Output     string `json:"output"`
+	StepOutput string `json:"step_output"`
+	ExitCode   int    `json:"exit_code"`
+}
+
+// ExternalResponse is read as JSON from the stdout of an external check.
+type ExternalResponse struct {
+	// OK reports whether the condition holds. Negation is applied by runner.
+	OK bool `json:"ok"`
+	// Message explains the result.
+	Message string `json:"message"`
+}
+
+// external runs a `runner-check-<name>` executable.
+type external struct {
+	name string
+	path string
+}
+
+// externalPaths caches where the executables of external checks were found,
+// by $PATH and name. Names without an executable are cached as "", so plain
+// text expectations such as `Error: ...` search $PATH only once.
+var externalPaths sync.Map
+
+// lookupExternal finds the executable of an external check in $PATH, the
+// first time a name that is not registered is used.
+func lookupExternal(name string) (Checker, bool) {
+	key := os.Getenv("PATH") + "\x00" + name
+	cached, ok := externalPaths.Load(key)
+	if !ok {
+		path, err := exec.LookPath(externalPrefix + strings.ToLower(name))
+		if err != nil {
+			path = ""
+		}
+		cached, _ = externalPaths.LoadOrStore(key, path)
+	}
+	if cached == "" {
+		return nil, false
+	}
+	return &external{name: name, path: cached.(string)}, true
+}
+
+func (e *external) Name() string { return e.name }
+
+func (e *external) Describe() string {
+	return fmt.Sprintf("external check %s", e.path)
+}
+
+func (e *external) Parse(arg string, options map[string]string) (Condition, error) {
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		resp, err := e.run(ExternalRequest{
+			Name:       e.name,
+			Argument:   arg,
+			Options:    options,
+			Output:     scope.output(),
+			StepOutput: scope.Normalize.Apply(scope.StepOutput),
+			ExitCode:   scope.ExitCode,
+		}, scope.Env)
+		if err != nil {
+			return err
+		}
+
+		message := resp.Message
+		if message == "" {
+			message = "no message"
+		}
+		if negate && resp.OK {
+			return fmt.Errorf("unexpected %s:%s holds: %s", e.name, arg, message)
+		}
+		if !negate && !resp.OK {
+			return fmt.Errorf("expected %s:%s does not hold: %s", e.name, arg, message)
+		}
+		return nil
+	}), nil
+}
+
+// run sends the request to the executable and decodes its response.
+func (e *external) run(req ExternalRequest, env []string) (ExternalResponse, error) {
+	var resp ExternalResponse
+
+	input, err := json.Marshal(req)
+	if err != nil {
+		return resp, err
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(e.path)
+	cmd.Env = env
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+
+	runErr := cmd.Run()
+	if err := json.Unmarshal(stdout.Bytes(), &resp); err != nil {
+		if runErr != nil {
+			return resp, fmt.Errorf("external check %s failed: %v: %s", e.path, runErr, strings.TrimSpace(stderr.String()))
+		}
+		return resp, fmt.Errorf("external check %s returned an invalid response: %v", e.path, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,75 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExternalChecker(t *testing.T) {
+	dir := t.TempDir()
+	script := `#!/bin/sh
+input=$(cat)
+case "$input" in
+  *'"argument":"up"'*) echo '{"ok": true, "message": "service is up"}' ;;
+  *'"argument":"broken"'*) echo "boom" >&2; exit 3 ;;
+  *) echo '{"ok": false, "message": "service is down"}' ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(dir, "runner-check-service"), []byte(script), 0755); err != nil {
+		t.Fatalf("failed to write external check: %v", err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	checker, ok := Lookup("SERVICE")
+	if !ok {
+		t.Fatalf("expected external check to be found")
+	}
+	if checker.Name() != "SERVICE" {
+		t.Errorf("expected name SERVICE, got %s", checker.Name())
+	}
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"SERVICE:up", false},
+		{"SERVICE:down", true},
+		{"!SERVICE:down", false},
+		{"!SERVICE:up", true},
+		{"SERVICE:broken", true},
+	}
+	for _, tt := range tests {
+		err := Evaluate(&Scope{}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	if _, ok := Lookup("MISSING_EXTERNAL"); ok {
+		t.Errorf("expected unknown external check not to be found")
+	}
+}
+
+func TestExternalLookupIsCached(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("PATH", dir)
+
+	if _, ok := Lookup("LATER"); ok {
+		t.Fatalf("expected no external check before it is installed")
+	}
+
+	// An executable installed after the first lookup is not searched for again
+	if err := os.WriteFile(filepath.Join(dir, "runner-check-later"), []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatalf("failed to write external check: %v", err)
+	}
+	if _, ok := Lookup("LATER"); ok {
+		t.Errorf("expected the missing executable to be cached")
+	}
+
+	// A different $PATH is searched again
+	t.Setenv("PATH", dir+string(os.PathListSeparator))
+	if _, ok := Lookup("LATER"); !ok {
+		t.Errorf("expected the external check to be found in the new $PATH")
+	}
+}
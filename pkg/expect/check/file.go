@@ -0,0 +1,296 @@
+package check
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// fileOptions are the assertions a FILE[...] check makes about a file.
+var fileOptions = []string{"contains", "matches", "sha256", "min_size", "mode", "owner", "newer_than", "older_than"}
+
+// fileFacts is what FILE: checks know about a file.
+type fileFacts struct {
+	size  int64
+	mode  os.FileMode
+	owner string
+	uid   string
+	mtime time.Time
+}
+
+// fileAssertions are the parsed options of a FILE[...] check.
+type fileAssertions struct {
+	options map[string]string
+	re      *regexp.Regexp
+	minSize uint64
+	// mode holds octal permission bits, including the setuid, setgid and sticky bits.
+	mode      os.FileMode
+	newerThan time.Duration
+	olderThan time.Duration
+}
+
+func parseFile(filePath string, options map[string]string) (Condition, error) {
+	assertions, err := parseFileAssertions(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		exists, err := fileExists(scope, filePath)
+		if err != nil {
+			return err
+		}
+
+		if len(options) == 0 {
+			if negate && exists {
+				return fmt.Errorf("unexpected file '%s' exists", filePath)
+			}
+			if !negate && !exists {
+				return fmt.Errorf("expected file '%s' does not exist", filePath)
+			}
+			return nil
+		}
+
+		err = fmt.Errorf("expected file '%s' does not exist", filePath)
+		if exists {
+			err = assertions.verify(scope, filePath)
+		}
+		if negate && err == nil {
+			return fmt.Errorf("unexpected file '%s' exists and matches %s", filePath, assertions)
+		}
+		if !negate && err != nil {
+			return err
+		}
+		return nil
+	}), nil
+}
+
+func parseFileAssertions(options map[string]string) (*fileAssertions, error) {
+	a := &fileAssertions{options: options}
+	var err error
+
+	if pattern, ok := options["matches"]; ok {
+		if a.re, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("invalid matches pattern '%s': %v", pattern, err)
+		}
+	}
+	if value, ok := options["min_size"]; ok {
+		if a.minSize, err = runnerexec.ParseSize(value); err != nil {
+			return nil, fmt.Errorf("invalid min_size '%s': %v", value, err)
+		}
+	}
+	if value, ok := options["mode"]; ok {
+		mode, err := strconv.ParseUint(value, 8, 32)
+		if err != nil || mode > 0o7777 {
+			return nil, fmt.Errorf("invalid mode '%s', expected octal permission bits such as 0644", value)
+		}
+		a.mode = os.FileMode(mode)
+	}
+	if value, ok := options["sha256"]; ok {
+		if _, err := hex.DecodeString(value); err != nil || len(value) != sha256.Size*2 {
+			return nil, fmt.Errorf("invalid sha256 '%s'", value)
+		}
+	}
+	if a.newerThan, err = durationOption(options, "newer_than", 0); err != nil {
+		return nil, err
+	}
+	if a.olderThan, err = durationOption(options, "older_than", 0); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// String lists the options of the assertions.
+func (a *fileAssertions) String() string {
+	var pairs []string
+	for _, key := range fileOptions {
+		if value, ok := a.options[key]; ok {
+			pairs = append(pairs, key+"="+value)
+		}
+	}
+	return strings.Join(pairs, ", ")
+}
+
+// verify checks the assertions against an existing file.
+func (a *fileAssertions) verify(scope *Scope, filePath string) error {
+	facts, err := statFile(scope, filePath)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := a.options["min_size"]; ok && uint64(facts.size) < a.minSize {
+		return fmt.Errorf("file '%s' is %d bytes, expected at least %s", filePath, facts.size, a.options["min_size"])
+	}
+	if _, ok := a.options["mode"]; ok && unixMode(facts.mode) != a.mode {
+		return fmt.Errorf("file '%s' has mode %04o, expected %s", filePath, unixMode(facts.mode), a.options["mode"])
+	}
+	if owner, ok := a.options["owner"]; ok && owner != facts.owner && owner != facts.uid {
+		return fmt.Errorf("file '%s' is owned by '%s', expected '%s'", filePath, facts.owner, owner)
+	}
+	age := time.Since(facts.mtime)
+	if a.newerThan > 0 && age > a.newerThan {
+		return fmt.Errorf("file '%s' was modified %s ago, expected newer than %s", filePath, age.Round(time.Second), a.newerThan)
+	}
+	if a.olderThan > 0 && age < a.olderThan {
+		return fmt.Errorf("file '%s' was modified %s ago, expected older than %s", filePath, age.Round(time.Second), a.olderThan)
+	}
+
+	_, wantContains := a.options["contains"]
+	wantSum, wantSHA := a.options["sha256"]
+	if !wantContains && !wantSHA && a.re == nil {
+		return nil
+	}
+
+	content, err := readFile(scope, filePath)
+	if err != nil {
+		return err
+	}
+	if text := a.options["contains"]; wantContains && !strings.Contains(string(content), text) {
+		return fmt.Errorf("file '%s' does not contain '%s'", filePath, text)
+	}
+	if a.re != nil && !a.re.Match(content) {
+		return fmt.Errorf("file '%s' does not match '%s'", filePath, a.re)
+	}
+	if wantSHA {
+		sum := sha256.Sum256(content)
+		if got := hex.EncodeToString(sum[:]); !strings.EqualFold(got, wantSum) {
+			return fmt.Errorf("file '%s' has sha256 %s, expected %s", filePath, got, wantSum)
+		}
+	}
+	return nil
+}
+
+// fileModeBits converts the setuid, setgid and sticky bits of an octal mode into their os.FileMode flags.
+func fileModeBits(mode os.FileMode) os.FileMode {
+	var bits os.FileMode
+	if mode&0o4000 != 0 {
+		bits |= os.ModeSetuid
+	}
+	if mode&0o2000 != 0 {
+		bits |= os.ModeSetgid
+	}
+	if mode&0o1000 != 0 {
+		bits |= os.ModeSticky
+	}
+	return bits
+}
+
+// unixMode converts an os.FileMode back into octal permission bits.
+func unixMode(mode os.FileMode) os.FileMode {
+	bits := mode.Perm()
+	if mode&os.ModeSetuid != 0 {
+		bits |= 0o4000
+	}
+	if mode&os.ModeSetgid != 0 {
+		bits |= 0o2000
+	}
+	if mode&os.ModeSticky != 0 {
+		bits |= 0o1000
+	}
+	return bits
+}
+
+// fileExists reports whether the path exists, on the remote host of the scope if any.
+func fileExists(scope *Scope, filePath string) (bool, error) {
+	if scope.Remote != nil {
+		exists, _, err := scope.runRemote("test -e " + runnerexec.ShellQuote(filePath))
+		return exists, err
+	}
+	_, err := os.Stat(filePath)
+	return !os.IsNotExist(err), nil
+}
+
+// statFile collects the facts about a file, on the remote host of the scope if any.
+func statFile(scope *Scope, filePath string) (fileFacts, error) {
+	if scope.Remote == nil {
+		info, err := os.Stat(filePath)
+		if err != nil {
+			return fileFacts{}, err
+		}
+		facts := fileFacts{size: info.Size(), mode: info.Mode(), mtime: info.ModTime()}
+		facts.owner, facts.uid = fileOwner(info)
+		return facts, nil
+	}
+
+	// GNU stat first, BSD stat otherwise
+	quoted := runnerexec.ShellQuote(filePath)
+	ok, out, err := scope.runRemote("stat -c '%s %a %U %u %Y' " + quoted + " 2>/dev/null || stat -f '%z %Lp %Su %u %m' " + quoted)
+	if err != nil {
+		return fileFacts{}, err
+	}
+	fields := strings.Fields(out)
+	if !ok || len(fields) != 5 {
+		return fileFacts{}, fmt.Errorf("failed to stat '%s' on the remote host: %s", filePath, strings.TrimSpace(out))
+	}
+
+	var facts fileFacts
+	facts.size, _ = strconv.ParseInt(fields[0], 10, 64)
+	mode, _ := strconv.ParseUint(fields[1], 8, 32)
+	facts.mode = os.FileMode(mode).Perm() | fileModeBits(os.FileMode(mode))
+	facts.owner, facts.uid = fields[2], fields[3]
+	mtime, _ := strconv.ParseInt(fields[4], 10, 64)
+	facts.mtime = time.Unix(mtime, 0)
+	return facts, nil
+}
+
+// readFile reads a file, on the remote host of the scope if any.
+func readFile(scope *Scope, filePath string) ([]byte, error) {
+	if scope.Remote == nil {
+		return os.ReadFile(filePath)
+	}
+	ok, out, err := scope.runRemote("cat " + runnerexec.ShellQuote(filePath))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed to read '%s' on the remote host: %s", filePath, strings.TrimSpace(out))
+	}
+	return []byte(out), nil
+}
+
+// writeFile writes a file, creating its directory, on the remote host of the
+// scope if any.
+func writeFile(scope *Scope, filePath string, data []byte) error {
+	if scope.Remote == nil {
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(filePath, data, 0644)
+	}
+	ok, out, err := scope.runRemote(fmt.Sprintf("mkdir -p %s && printf '%%s' %s > %s",
+		runnerexec.ShellQuote(path.Dir(filePath)), runnerexec.ShellQuote(string(data)), runnerexec.ShellQuote(filePath)))
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return fmt.Errorf("failed to write '%s' on the remote host: %s", filePath, strings.TrimSpace(out))
+	}
+	return nil
+}
+
+// resolvePath resolves a relative path against the working directory of the
+// scope, the way the command that produced the output sees it.
+func (s *Scope) resolvePath(filePath string) string {
+	if s.Dir == "" {
+		return filePath
+	}
+	if s.Remote != nil {
+		if path.IsAbs(filePath) {
+			return filePath
+		}
+		return path.Join(s.Dir, filePath)
+	}
+	if filepath.IsAbs(filePath) {
+		return filePath
+	}
+	return filepath.Join(s.Dir, filePath)
+}
@@ -0,0 +1,10 @@
+//go:build windows
+
+package check
+
+import "os"
+
+// fileOwner is not supported on Windows.
+func fileOwner(info os.FileInfo) (string, string) {
+	return "", ""
+}
@@ -0,0 +1,78 @@
+package check
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"os/user"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileExpectations(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "artifact.txt")
+	content := []byte("version: 1.4.2\nstatus: built\n")
+	if err := os.WriteFile(path, content, 0640); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatalf("failed to chmod file: %v", err)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	oldPath := filepath.Join(dir, "old.txt")
+	if err := os.WriteFile(oldPath, nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if err := os.Chtimes(oldPath, old, old); err != nil {
+		t.Fatalf("failed to set file times: %v", err)
+	}
+
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+	current, err := user.Current()
+	if err != nil {
+		t.Fatalf("failed to get current user: %v", err)
+	}
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"FILE:" + path, false},
+		{"FILE[contains=status: built]:" + path, false},
+		{"FILE[contains=failed]:" + path, true},
+		{`FILE[matches='version: 1\.\d+\.\d+']:` + path, false},
+		{"FILE[matches=^status]:" + path, true},
+		{"FILE[sha256=" + checksum + "]:" + path, false},
+		{"FILE[sha256=" + checksum[:63] + "0]:" + path, true},
+		{"FILE[min_size=10]:" + path, false},
+		{"FILE[min_size=1KB]:" + path, true},
+		{"FILE[mode=0640]:" + path, false},
+		{"FILE[mode=640]:" + path, false},
+		{"FILE[mode=0644]:" + path, true},
+		{"FILE[owner=" + current.Username + "]:" + path, false},
+		{"FILE[owner=" + current.Uid + "]:" + path, false},
+		{"FILE[owner=nobody-at-all]:" + path, true},
+		{"FILE[newer_than=10m]:" + path, false},
+		{"FILE[newer_than=10m]:" + oldPath, true},
+		{"FILE[older_than=1h]:" + oldPath, false},
+		{"FILE[older_than=1h]:" + path, true},
+		{"FILE[contains=built,min_size=10,newer_than=1h]:" + path, false},
+		{"FILE[contains=built]:" + filepath.Join(dir, "missing.txt"), true},
+		{"!FILE[contains=failed]:" + path, false},
+		{"!FILE[contains=built]:" + path, true},
+		{"!FILE[contains=built]:" + filepath.Join(dir, "missing.txt"), false},
+		{"FILE[mode=rwx]:" + path, true},
+		{"FILE[sha256=abc]:" + path, true},
+		{"FILE[size=10]:" + path, true},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(&Scope{}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+}
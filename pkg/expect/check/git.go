@@ -0,0 +1,210 @@
+package check
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// gitOptions are the options of GIT[...] checks.
+var gitOptions = []string{"dir", "since"}
+
+// gitAssertion is one `key` or `key=value` part of a GIT: check.
+type gitAssertion struct {
+	key   string
+	value string
+}
+
+// parseGit builds the GIT: condition from a comma separated list of assertions
+// about the repository in the dir option, or the working directory of the step:
+//
+//	clean            the working tree has no changes or untracked files
+//	branch=pattern   the current branch matches the glob pattern
+//	tag=pattern      HEAD is tagged with a tag matching the glob pattern
+//	contains=ref     HEAD contains the commit of the ref
+//	pushed           HEAD has no commits missing from its upstream
+//	changed=path     the path changed since the since option, HEAD unless set
+func parseGit(arg string, options map[string]string) (Condition, error) {
+	var assertions []gitAssertion
+	for _, part := range strings.Split(arg, ",") {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "clean", "pushed":
+			if hasValue {
+				return nil, fmt.Errorf("GIT assertion '%s' takes no value", key)
+			}
+		case "branch", "tag", "contains", "changed":
+			if value == "" {
+				return nil, fmt.Errorf("GIT assertion '%s' needs a value, i.e. %s=main", key, key)
+			}
+			if _, err := path.Match(value, ""); err != nil && (key == "branch" || key == "tag") {
+				return nil, fmt.Errorf("invalid %s pattern '%s': %v", key, value, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown GIT assertion '%s', expected clean, branch, tag, contains, pushed or changed", key)
+		}
+		assertions = append(assertions, gitAssertion{key: key, value: value})
+	}
+
+	since := options["since"]
+	if since == "" {
+		since = "HEAD"
+	}
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		repo := gitRepo{scope: scope, dir: options["dir"]}
+
+		var failure error
+		for _, a := range assertions {
+			holds, reason, err := repo.check(a, since)
+			if err != nil {
+				return err
+			}
+			if !holds {
+				failure = fmt.Errorf("%s", reason)
+				break
+			}
+		}
+
+		if negate && failure == nil {
+			return fmt.Errorf("unexpected git repository %s matches %s", repo, arg)
+		}
+		if !negate && failure != nil {
+			return failure
+		}
+		return nil
+	}), nil
+}
+
+// gitRepo runs git commands through the executor of the scope, in dir
+// relative to the working directory of the step.
+type gitRepo struct {
+	scope *Scope
+	dir   string
+}
+
+func (r gitRepo) String() string {
+	switch {
+	case r.dir != "":
+		return fmt.Sprintf("in '%s'", r.dir)
+	case r.scope.Dir != "":
+		return fmt.Sprintf("in '%s'", r.scope.Dir)
+	default:
+		return "in the working directory"
+	}
+}
+
+// git runs a git command and returns its trimmed output and exit status.
+func (r gitRepo) git(args string) (string, int, error) {
+	command := "git " + args
+	if r.dir != "" {
+		command = "git -C " + runnerexec.ShellQuote(r.dir) + " " + args
+	}
+	result := <-runnerexec.Execute(r.scope.executor(), runnerexec.Command{
+		Exec:    command,
+		Env:     r.scope.commandEnv(),
+		Dir:     r.scope.Dir,
+		Timeout: r.scope.Timeout,
+	}, nil)
+	output := strings.TrimSpace(result.Output)
+	if result.ExitCode == 0 && result.Err != nil {
+		return output, -1, fmt.Errorf("'%s' failed: %w", command, result.Err)
+	}
+	return output, result.ExitCode, nil
+}
+
+// mustGit runs a git command that is expected to succeed.
+func (r gitRepo) mustGit(args string) (string, error) {
+	output, status, err := r.git(args)
+	if err != nil {
+		return "", err
+	}
+	if status != 0 {
+		return "", fmt.Errorf("git %s %s failed: %s", args, r, output)
+	}
+	return output, nil
+}
+
+// check evaluates one assertion and explains why it does not hold.
+func (r gitRepo) check(a gitAssertion, since string) (bool, string, error) {
+	switch a.key {
+	case "clean":
+		status, err := r.mustGit("status --porcelain")
+		if err != nil || status == "" {
+			return true, "", err
+		}
+		lines := strings.Split(status, "\n")
+		return false, fmt.Sprintf("git working tree %s is not clean: %s", r, strings.Join(lines[:min(len(lines), 5)], ", ")), nil
+
+	case "branch":
+		branch, status, err := r.git("symbolic-ref --short -q HEAD")
+		if err != nil {
+			return false, "", err
+		}
+		if status != 0 {
+			return false, fmt.Sprintf("git HEAD %s is detached, expected branch '%s'", r, a.value), nil
+		}
+		if ok, _ := path.Match(a.value, branch); !ok {
+			return false, fmt.Sprintf("git branch %s is '%s', expected '%s'", r, branch, a.value), nil
+		}
+		return true, "", nil
+
+	case "tag":
+		tags, err := r.mustGit("tag --points-at HEAD")
+		if err != nil {
+			return false, "", err
+		}
+		for _, tag := range strings.Fields(tags) {
+			if ok, _ := path.Match(a.value, tag); ok {
+				return true, "", nil
+			}
+		}
+		if tags == "" {
+			tags = "none"
+		}
+		return false, fmt.Sprintf("git HEAD %s is not tagged '%s', tags: %s", r, a.value, strings.Join(strings.Fields(tags), ", ")), nil
+
+	case "contains":
+		output, status, err := r.git("merge-base --is-ancestor " + runnerexec.ShellQuote(a.value) + " HEAD")
+		if err != nil {
+			return false, "", err
+		}
+		switch status {
+		case 0:
+			return true, "", nil
+		case 1:
+			return false, fmt.Sprintf("git HEAD %s does not contain '%s'", r, a.value), nil
+		}
+		return false, "", fmt.Errorf("git merge-base %s failed: %s", r, output)
+
+	case "pushed":
+		output, status, err := r.git("rev-list --count '@{upstream}..HEAD'")
+		if err != nil {
+			return false, "", err
+		}
+		if status != 0 {
+			return false, fmt.Sprintf("git branch %s has no upstream: %s", r, output), nil
+		}
+		if count, _ := strconv.Atoi(output); count > 0 {
+			return false, fmt.Sprintf("git branch %s has %d unpushed commits", r, count), nil
+		}
+		return true, "", nil
+
+	case "changed":
+		output, status, err := r.git("diff --quiet " + runnerexec.ShellQuote(since) + " -- " + runnerexec.ShellQuote(a.value))
+		if err != nil {
+			return false, "", err
+		}
+		switch status {
+		case 0:
+			return false, fmt.Sprintf("'%s' has not changed since '%s' %s", a.value, since, r), nil
+		case 1:
+			return true, "", nil
+		}
+		return false, "", fmt.Errorf("git diff %s failed: %s", r, output)
+	}
+	return false, "", fmt.Errorf("unknown GIT assertion '%s'", a.key)
+}
@@ -0,0 +1,116 @@
+package check
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func setupGitRepo(t *testing.T) (string, func(args ...string)) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	repo := filepath.Join(dir, "repo")
+	t.Setenv("GIT_CONFIG_GLOBAL", os.DevNull)
+	t.Setenv("GIT_AUTHOR_NAME", "runner")
+	t.Setenv("GIT_AUTHOR_EMAIL", "runner@example.com")
+	t.Setenv("GIT_COMMITTER_NAME", "runner")
+	t.Setenv("GIT_COMMITTER_EMAIL", "runner@example.com")
+
+	git := func(args ...string) {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = dir
+		if _, err := os.Stat(repo); err == nil {
+			cmd.Dir = repo
+		}
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, output)
+		}
+	}
+	git("init", "-q", "--bare", "origin.git")
+	git("init", "-q", "-b", "main", "repo")
+	return repo, git
+}
+
+func TestGitExpectations(t *testing.T) {
+	repo, git := setupGitRepo(t)
+
+	if err := os.MkdirAll(filepath.Join(repo, "charts"), 0755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+	for _, name := range []string{"README.md", "charts/values.yaml"} {
+		if err := os.WriteFile(filepath.Join(repo, name), []byte(name), 0644); err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+	git("add", "-A")
+	git("commit", "-q", "-m", "initial")
+	git("tag", "v1.2.0")
+	git("remote", "add", "origin", "../origin.git")
+	git("push", "-q", "-u", "origin", "main")
+
+	if err := os.WriteFile(filepath.Join(repo, "charts/values.yaml"), []byte("replicas: 2"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	git("commit", "-q", "-am", "scale")
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"GIT:clean", false},
+		{"GIT:branch=main", false},
+		{"GIT:branch=release/*", true},
+		{"!GIT:branch=release/*", false},
+		{"GIT:tag=v1.*", true},
+		{"GIT:contains=v1.2.0", false},
+		{"GIT:contains=no-such-ref", true},
+		{"GIT:pushed", true},
+		{"GIT[since=v1.2.0]:changed=charts/", false},
+		{"GIT[since=v1.2.0]:changed=README.md", true},
+		{"GIT:changed=charts/", true},
+		{"GIT:clean,branch=main,contains=v1.2.0", false},
+		{"GIT:clean,pushed", true},
+		{"GIT:dirty", true},
+		{"GIT:branch", true},
+		{"GIT:clean=yes", true},
+	}
+	for _, tt := range tests {
+		err := Evaluate(&Scope{Dir: repo}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	git("push", "-q")
+	git("tag", "v1.3.0")
+	if err := os.WriteFile(filepath.Join(repo, "notes.txt"), nil, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	for _, tt := range []struct {
+		expectation string
+		expectError bool
+	}{
+		{"GIT:pushed", false},
+		{"GIT:tag=v1.*", false},
+		{"GIT:clean", true},
+		{"!GIT:clean", false},
+	} {
+		err := Evaluate(&Scope{Dir: repo}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	if err := Evaluate(&Scope{Dir: filepath.Dir(repo)}, []string{"GIT[dir=repo]:branch=main"}); err != nil {
+		t.Errorf("expected the dir option to be relative to the step directory, got %v", err)
+	}
+
+	err := Evaluate(&Scope{Dir: repo}, []string{"GIT:branch=release/*"})
+	if err == nil || err.Error() != "git branch in '"+repo+"' is 'main', expected 'release/*'" {
+		t.Errorf("expected the current and expected branch in the error, got %v", err)
+	}
+}
@@ -0,0 +1,216 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+)
+
+var (
+	goldenMu     sync.RWMutex
+	updateGolden bool
+)
+
+// goldenContext is the number of unchanged lines around the changes of a golden diff.
+const goldenContext = 3
+
+// goldenDiffLines is the number of lines of a golden diff shown in an error.
+const goldenDiffLines = 100
+
+// UpdateGolden reports whether GOLDEN: checks rewrite their golden files
+// instead of comparing them.
+func UpdateGolden() bool {
+	goldenMu.RLock()
+	defer goldenMu.RUnlock()
+	return updateGolden
+}
+
+// SetUpdateGolden sets whether GOLDEN: checks rewrite their golden files
+// with the output instead of comparing them.
+func SetUpdateGolden(update bool) {
+	goldenMu.Lock()
+	defer goldenMu.Unlock()
+	updateGolden = update
+}
+
+// parseGolden builds the GOLDEN: condition, which compares the step output,
+// or the file in the file option, with the contents of a golden file.
+func parseGolden(goldenPath string, options map[string]string) (Condition, error) {
+	if goldenPath == "" {
+		return nil, fmt.Errorf("GOLDEN needs the path of a golden file, i.e. GOLDEN:testdata/expected.txt")
+	}
+	produced := options["file"]
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		goldenPath := scope.resolvePath(goldenPath)
+		actual, source := scope.stepOutput(), "output"
+		if produced != "" {
+			producedPath := scope.resolvePath(produced)
+			data, err := readFile(scope, producedPath)
+			if err != nil {
+				return fmt.Errorf("failed to read '%s': %v", producedPath, err)
+			}
+			actual, source = string(data), producedPath
+		}
+
+		if UpdateGolden() && !negate {
+			if err := writeFile(scope, goldenPath, []byte(actual)); err != nil {
+				return fmt.Errorf("failed to update golden file '%s': %v", goldenPath, err)
+			}
+			return nil
+		}
+
+		exists, err := fileExists(scope, goldenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read golden file '%s': %v", goldenPath, err)
+		}
+		if !exists {
+			if negate {
+				return nil
+			}
+			return fmt.Errorf("golden file '%s' does not exist, run with --update-golden to create it", goldenPath)
+		}
+		expected, err := readFile(scope, goldenPath)
+		if err != nil {
+			return fmt.Errorf("failed to read golden file '%s': %v", goldenPath, err)
+		}
+
+		matches := string(expected) == actual
+		if negate && matches {
+			return fmt.Errorf("unexpected %s matches golden file '%s'", source, goldenPath)
+		}
+		if !negate && !matches {
+			return fmt.Errorf("%s does not match golden file '%s':\n%s", source, goldenPath,
+				unifiedDiff(goldenPath, source, string(expected), actual))
+		}
+		return nil
+	}), nil
+}
+
+// diffOp is a line of a diff: ' ' when unchanged, '-' when removed and '+' when added.
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// diffLines computes a line diff of a and b from their longest common subsequence.
+func diffLines(a, b []string) []diffOp {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	return ops
+}
+
+// unifiedDiff renders the differences between the expected and actual text
+// as a unified diff, with goldenContext lines of context around each change.
+func unifiedDiff(expectedName, actualName, expected, actual string) string {
+	ops := diffLines(splitLines(expected), splitLines(actual))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", expectedName, actualName)
+
+	for start := 0; start < len(ops); {
+		// find the next change and the extent of its hunk
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		from := max(start-goldenContext, 0)
+		end, unchanged := start, 0
+		for end < len(ops) && unchanged <= 2*goldenContext {
+			if ops[end].kind == ' ' {
+				unchanged++
+			} else {
+				unchanged = 0
+			}
+			end++
+		}
+		to := min(end-unchanged+goldenContext, len(ops))
+
+		aStart, bStart := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				aStart++
+			}
+			if op.kind != '-' {
+				bStart++
+			}
+		}
+		aLen, bLen := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				aLen++
+			}
+			if op.kind != '-' {
+				bLen++
+			}
+		}
+		fmt.Fprintf(&b, "@@ -%s +%s @@\n", hunkRange(aStart, aLen), hunkRange(bStart, bLen))
+		for _, op := range ops[from:to] {
+			fmt.Fprintf(&b, "%c%s\n", op.kind, op.line)
+		}
+		start = to
+	}
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) > goldenDiffLines {
+		lines = append(lines[:goldenDiffLines], fmt.Sprintf("... %d more lines", len(lines)-goldenDiffLines))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// hunkRange formats the start and length of a hunk. Empty ranges start at
+// the line before them, as in diff -u.
+func hunkRange(start, length int) string {
+	if length == 0 {
+		start--
+	}
+	if length == 1 {
+		return fmt.Sprint(start)
+	}
+	return fmt.Sprintf("%d,%d", start, length)
+}
+
+// splitLines splits text into lines, marking a missing final line break so
+// that it shows in diffs.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.Split(text, "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n\\ No newline at end of file"
+	return lines
+}
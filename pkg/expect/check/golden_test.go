@@ -0,0 +1,172 @@
+package check
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+func TestGoldenCheck(t *testing.T) {
+	dir := t.TempDir()
+	golden := filepath.Join(dir, "expected.txt")
+	if err := os.WriteFile(golden, []byte("name: web\nreplicas: 3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	produced := filepath.Join(dir, "manifest.yaml")
+	if err := os.WriteFile(produced, []byte("name: web\nreplicas: 2\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		output      string
+		expectation string
+		expectError bool
+	}{
+		{"name: web\nreplicas: 3\n", "GOLDEN:" + golden, false},
+		{"name: web\nreplicas: 2\n", "GOLDEN:" + golden, true},
+		{"name: web\nreplicas: 2\n", "!GOLDEN:" + golden, false},
+		{"name: web\nreplicas: 3", "GOLDEN:" + golden, true},
+		{"name: web\nreplicas: 3\n", "GOLDEN[file=" + produced + "]:" + golden, true},
+		{"", "GOLDEN[file=" + filepath.Join(dir, "missing") + "]:" + golden, true},
+		{"", "GOLDEN:" + filepath.Join(dir, "missing.txt"), true},
+		{"", "!GOLDEN:" + filepath.Join(dir, "missing.txt"), false},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(&Scope{Output: tt.output, StepOutput: tt.output}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	err := Evaluate(&Scope{StepOutput: "name: web\nreplicas: 2\n"}, []string{"GOLDEN:" + golden})
+	expected := "--- " + golden + "\n+++ output\n@@ -1,2 +1,2 @@\n name: web\n-replicas: 3\n+replicas: 2"
+	if err == nil || !strings.HasSuffix(err.Error(), expected) {
+		t.Errorf("expected a unified diff ending in\n%s\ngot %v", expected, err)
+	}
+}
+
+func TestUpdateGolden(t *testing.T) {
+	SetUpdateGolden(true)
+	defer SetUpdateGolden(false)
+
+	golden := filepath.Join(t.TempDir(), "testdata", "expected.txt")
+	if err := Evaluate(&Scope{StepOutput: "v2\n"}, []string{"GOLDEN:" + golden}); err != nil {
+		t.Fatalf("expected the golden file to be written, got %v", err)
+	}
+	if data, err := os.ReadFile(golden); err != nil || string(data) != "v2\n" {
+		t.Errorf("expected golden file 'v2\\n', got %q, %v", data, err)
+	}
+
+	SetUpdateGolden(false)
+	if err := Evaluate(&Scope{StepOutput: "v2\n"}, []string{"GOLDEN:" + golden}); err != nil {
+		t.Errorf("expected the updated golden file to match, got %v", err)
+	}
+}
+
+func TestGoldenSilentStep(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "empty.txt")
+	if err := os.WriteFile(golden, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Earlier steps printed output, the step itself printed nothing
+	scope := &Scope{Output: "building\ndone\n", HasStepOutput: true}
+
+	if err := Evaluate(scope, []string{"GOLDEN:" + golden}); err != nil {
+		t.Errorf("expected the silent step to match the empty golden file, got %v", err)
+	}
+
+	SetUpdateGolden(true)
+	defer SetUpdateGolden(false)
+	if err := os.WriteFile(golden, []byte("stale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Evaluate(scope, []string{"GOLDEN:" + golden}); err != nil {
+		t.Fatalf("expected the golden file to be written, got %v", err)
+	}
+	if data, err := os.ReadFile(golden); err != nil || len(data) != 0 {
+		t.Errorf("expected an empty golden file, got %q, %v", data, err)
+	}
+}
+
+func TestGoldenPathsFollowScope(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "produced.txt"), []byte("v1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	SetUpdateGolden(true)
+	defer SetUpdateGolden(false)
+	// A local shell stands in for the remote host; the golden file must be written through it.
+	recorder := runnerexec.NewRecordingExecutor(runnerexec.LocalExecutor{})
+	for _, scope := range []*Scope{{Dir: dir}, {Dir: dir, Remote: recorder}} {
+		if err := Evaluate(scope, []string{"GOLDEN[file=produced.txt]:testdata/expected.txt"}); err != nil {
+			t.Fatalf("expected the golden file to be written, got %v", err)
+		}
+	}
+	if len(recorder.Commands()) == 0 {
+		t.Errorf("expected the remote scope to go through its executor")
+	}
+	if data, err := os.ReadFile(filepath.Join(dir, "testdata", "expected.txt")); err != nil || string(data) != "v1\n" {
+		t.Errorf("expected golden file 'v1\\n' in the scope directory, got %q, %v", data, err)
+	}
+
+	SetUpdateGolden(false)
+	tests := []struct {
+		scope       *Scope
+		expectation string
+		expectError bool
+	}{
+		{&Scope{Dir: dir}, "GOLDEN[file=produced.txt]:testdata/expected.txt", false},
+		{&Scope{Dir: dir, StepOutput: "v1\n"}, "GOLDEN:testdata/expected.txt", false},
+		{&Scope{Dir: dir, Remote: recorder, StepOutput: "v1\n"}, "GOLDEN:testdata/expected.txt", false},
+		{&Scope{Dir: dir, Remote: recorder, StepOutput: "v2\n"}, "GOLDEN:testdata/expected.txt", true},
+		{&Scope{Dir: dir, Remote: recorder}, "!GOLDEN:testdata/missing.txt", false},
+		{&Scope{StepOutput: "v1\n"}, "GOLDEN:testdata/expected.txt", true},
+	}
+	for _, tt := range tests {
+		err := Evaluate(tt.scope, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s in '%s': expected error %v, got %v", tt.expectation, tt.scope.Dir, tt.expectError, err)
+		}
+	}
+}
+
+func TestUnifiedDiff(t *testing.T) {
+	var expected, actual []string
+	for i := 1; i <= 20; i++ {
+		expected = append(expected, strings.Repeat("x", i))
+		actual = append(actual, strings.Repeat("x", i))
+	}
+	actual[1] = "changed"
+	actual = append(actual[:15], actual[16:]...)
+
+	diff := unifiedDiff("a", "b", strings.Join(expected, "\n")+"\n", strings.Join(actual, "\n")+"\n")
+	want := `--- a
++++ b
+@@ -1,5 +1,5 @@
+ x
+-xx
++changed
+ xxx
+ xxxx
+ xxxxx
+@@ -13,7 +13,6 @@
+ xxxxxxxxxxxxx
+ xxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxx
+-xxxxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxxxxx
+ xxxxxxxxxxxxxxxxxxx`
+	if diff != want {
+		t.Errorf("expected diff\n%s\ngot\n%s", want, diff)
+	}
+
+	if diff := unifiedDiff("a", "b", "one\n", "one"); !strings.Contains(diff, "+one\n\\ No newline at end of file") {
+		t.Errorf("expected a missing final line break to show, got\n%s", diff)
+	}
+}
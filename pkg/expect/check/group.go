@@ -0,0 +1,171 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// groupKinds are the keys of rules that combine other rules.
+var groupKinds = []string{"all", "any", "none"}
+
+// Result is the outcome of a rule and, for groups, of the rules in it.
+type Result struct {
+	// Rule describes the rule, i.e. `CMD:helm` or `any`.
+	Rule string
+	// Err is nil when the rule passed.
+	Err error
+	// Skipped marks rules of a group that were not evaluated, because the
+	// outcome of the group was already decided, and rules that depend on a
+	// command not run in a dry run, which Err explains.
+	Skipped  bool
+	Children []*Result
+}
+
+// Passed reports whether the rule was evaluated and passed.
+func (r *Result) Passed() bool {
+	return !r.Skipped && r.Err == nil
+}
+
+// String renders the result as an indented tree, one rule per line.
+func (r *Result) String() string {
+	var b strings.Builder
+	r.write(&b, 0)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (r *Result) write(b *strings.Builder, depth int) {
+	b.WriteString(strings.Repeat("  ", depth))
+	switch {
+	case r.Skipped && r.Err != nil:
+		fmt.Fprintf(b, "[skipped] %s: %v\n", r.Rule, r.Err)
+	case r.Skipped:
+		fmt.Fprintf(b, "[skipped] %s\n", r.Rule)
+	case r.Err == nil:
+		fmt.Fprintf(b, "[passed] %s\n", r.Rule)
+	case len(r.Children) > 0:
+		fmt.Fprintf(b, "[failed] %s\n", r.Rule)
+	default:
+		fmt.Fprintf(b, "[failed] %s: %v\n", r.Rule, r.Err)
+	}
+	for _, child := range r.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// GroupError is returned when an `all`, `any` or `none` group fails. It
+// carries the result tree of the group.
+type GroupError struct {
+	Result *Result
+}
+
+func (e *GroupError) Error() string {
+	return fmt.Sprintf("%s group failed:\n%s", e.Result.Rule, e.Result)
+}
+
+// EvaluateResult evaluates a rule as it is written in YAML and returns its result tree.
+func EvaluateResult(scope *Scope, rule interface{}) *Result {
+	if r, ok := rule.(map[interface{}]interface{}); ok && len(r) == 1 {
+		for key, value := range r {
+			if cond, name := parseModifiers(fmt.Sprint(key)); contains(groupKinds, name) {
+				return evaluateGroup(scope, fmt.Sprint(key), cond, name, value)
+			}
+		}
+	}
+	err := evaluateRule(scope, rule)
+	return &Result{Rule: describeRule(rule), Err: err, Skipped: errors.Is(err, runnerexec.ErrDryRun)}
+}
+
+// EvaluateResults evaluates rules as EvaluateResult does, concurrently, and
+// returns their results in order. Unlike EvaluateRules, a failed rule does not
+// stop the rules after it.
+func EvaluateResults(scope *Scope, rules []interface{}) []*Result {
+	results := make([]*Result, len(rules))
+	evaluateAll(scope, len(rules), listConcurrency(allIndependent(rules)), func(scope *Scope, i int) error {
+		results[i] = EvaluateResult(scope, rules[i])
+		return nil
+	})
+	for i, result := range results {
+		if result == nil {
+			results[i] = &Result{Rule: describeRule(rules[i]), Skipped: true}
+		}
+	}
+	return results
+}
+
+// evaluateGroup evaluates the rules of an `all`, `any` or `none` group in
+// order, until the outcome of the group is decided.
+func evaluateGroup(scope *Scope, label string, cond condition, kind string, value interface{}) *Result {
+	result := &Result{Rule: label}
+	rules, ok := value.([]interface{})
+	if !ok || len(rules) == 0 {
+		result.Err = fmt.Errorf("%s group expects a list of rules", kind)
+		return result
+	}
+
+	evaluate := func() error {
+		result.Children = result.Children[:0]
+		decided, dryRun := false, false
+		passed := 0
+		for _, rule := range rules {
+			if decided {
+				result.Children = append(result.Children, &Result{Rule: describeRule(rule), Skipped: true})
+				continue
+			}
+			child := EvaluateResult(scope, rule)
+			result.Children = append(result.Children, child)
+			if isExpandError(child.Err) {
+				return fmt.Errorf("%s group: %w", kind, child.Err)
+			}
+			if child.Passed() {
+				passed++
+			}
+			dryRun = dryRun || errors.Is(child.Err, runnerexec.ErrDryRun)
+			// all fails on the first failure, any passes and none fails on the first pass
+			decided = kind == "all" && !child.Passed() || kind != "all" && child.Passed()
+		}
+
+		holds := passed == len(rules)
+		switch kind {
+		case "any":
+			holds = passed > 0
+		case "none":
+			holds = passed == 0
+		}
+		if holds == cond.negate {
+			if dryRun {
+				return fmt.Errorf("%s group depends on a %w", kind, runnerexec.ErrDryRun)
+			}
+			if cond.negate {
+				return fmt.Errorf("unexpected %s group passed", kind)
+			}
+			return &GroupError{Result: result}
+		}
+		return nil
+	}
+
+	result.Err = retryCheck(evaluate, cond.persistent && !scope.Once, scope.retryPolicy(), scope.done)
+	result.Skipped = errors.Is(result.Err, runnerexec.ErrDryRun)
+	return result
+}
+
+// describeRule is the label of a rule in a result tree.
+func describeRule(rule interface{}) string {
+	switch r := rule.(type) {
+	case string:
+		return r
+	case int:
+		return strconv.Itoa(r)
+	case map[interface{}]interface{}:
+		for key, value := range r {
+			if m, ok := value.(map[interface{}]interface{}); ok && m["url"] != nil {
+				return fmt.Sprintf("%v: %v", key, m["url"])
+			}
+			return fmt.Sprint(key)
+		}
+	}
+	return fmt.Sprint(rule)
+}
@@ -0,0 +1,81 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestGroupRules(t *testing.T) {
+	scope := &Scope{StepOutput: "build ok", Output: "build ok"}
+
+	tests := []struct {
+		name        string
+		rules       string
+		expectError bool
+	}{
+		{"all passes", "- all: [CMD:sh, 'TEXT:build']", false},
+		{"all fails", "- all: [CMD:sh, CMD:nonexistentcmd]", true},
+		{"any passes", "- any: [CMD:nonexistentcmd, CMD:sh]", false},
+		{"any fails", "- any: [CMD:nonexistentcmd, 'TEXT:failed']", true},
+		{"none passes", "- none: [CMD:nonexistentcmd, 'TEXT:failed']", false},
+		{"none fails", "- none: [CMD:nonexistentcmd, CMD:sh]", true},
+		{"negated any", "- '!any': [CMD:nonexistentcmd, 'TEXT:failed']", false},
+		{"nested", "- any:\n  - CMD:nonexistentcmd\n  - all:\n    - CMD:sh\n    - none: ['TEXT:failed']", false},
+		{"exit status", "- any: [1, 0]", false},
+		{"empty group", "- any: []", true},
+		{"not a list", "- any: CMD:sh", true},
+	}
+
+	for _, tt := range tests {
+		err := EvaluateRules(scope, parseRule(t, tt.rules).([]interface{}))
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.name, tt.expectError, err)
+		}
+	}
+}
+
+func TestGroupResultTree(t *testing.T) {
+	rules := parseRule(t, `
+- any:
+  - CMD:nonexistentcmd
+  - all:
+    - CMD:sh
+    - TEXT:missing
+  - CMD:sh
+  - CMD:ls
+`).([]interface{})
+
+	result := EvaluateResult(&Scope{Output: "build ok"}, rules[0])
+	if !result.Passed() {
+		t.Fatalf("expected the group to pass, got %v", result.Err)
+	}
+
+	expected := `[passed] any
+  [failed] CMD:nonexistentcmd: expected executable path 'nonexistentcmd' does not exist
+  [failed] all
+    [passed] CMD:sh
+    [failed] TEXT:missing: expected 'missing' not found in output
+  [passed] CMD:sh
+  [skipped] CMD:ls`
+	if result.String() != expected {
+		t.Errorf("expected result tree\n%s\ngot\n%s", expected, result)
+	}
+
+	err := EvaluateRules(&Scope{Output: "build ok"}, parseRule(t, "- all: [CMD:sh, CMD:nonexistentcmd]").([]interface{}))
+	var groupErr *GroupError
+	if !errors.As(err, &groupErr) || !strings.Contains(err.Error(), "[failed] CMD:nonexistentcmd") {
+		t.Errorf("expected a group error with the result tree, got %v", err)
+	}
+
+	// Unlike EvaluateRules, every rule gets a result
+	results := EvaluateResults(&Scope{}, []interface{}{"CMD:nonexistentcmd", "CMD:sh", "!CMD:sh"})
+	var passed []bool
+	for _, result := range results {
+		passed = append(passed, result.Passed())
+	}
+	if fmt.Sprint(passed) != "[false true false]" {
+		t.Errorf("expected results [false true false] in order, got %v", passed)
+	}
+}
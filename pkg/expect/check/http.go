@@ -0,0 +1,313 @@
+package check
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/expect/process"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultHTTPTimeout limits a single request of an http: check.
+const defaultHTTPTimeout = 10 * time.Second
+
+// maxHTTPBody is how much of a response body an http: check reads.
+const maxHTTPBody = 10 << 20
+
+// HTTPCheck is the structured form of an HTTP check, written as an `http:`
+// item of a check, expect or skip list.
+type HTTPCheck struct {
+	URL     string            `yaml:"url"`
+	Method  string            `yaml:"method"`
+	Headers map[string]string `yaml:"headers"`
+	Body    string            `yaml:"body"`
+	// Status lists the accepted statuses as codes (204), classes (2xx) or
+	// ranges (200-299). Defaults to 2xx.
+	Status statusList `yaml:"status"`
+	// Contains is a substring the response body must contain.
+	Contains string `yaml:"contains"`
+	// Matches is a regular expression the response body must match.
+	Matches string `yaml:"matches"`
+	// JSON maps paths in the JSON response body to their expected values.
+	JSON    map[string]interface{} `yaml:"json"`
+	TLS     HTTPTLS                `yaml:"tls"`
+	Timeout time.Duration          `yaml:"timeout"`
+	// FollowRedirects defaults to true.
+	FollowRedirects *bool `yaml:"follow_redirects"`
+	// Retry holds the retry options of a persistent (`@http:`) check.
+	Retry map[string]string `yaml:"retry"`
+}
+
+// HTTPTLS holds the TLS settings of an http: check.
+type HTTPTLS struct {
+	// CA is a PEM file with the certificates used to verify the server.
+	CA string `yaml:"ca"`
+	// Cert and Key are the PEM files of a client certificate.
+	Cert               string `yaml:"cert"`
+	Key                string `yaml:"key"`
+	ServerName         string `yaml:"server_name"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+}
+
+// statusList accepts a single status as well as a list of them.
+type statusList []string
+
+func (s *statusList) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var list []string
+	if err := unmarshal(&list); err == nil {
+		*s = list
+		return nil
+	}
+	var single string
+	if err := unmarshal(&single); err != nil {
+		return err
+	}
+	*s = statusList{single}
+	return nil
+}
+
+// parseHTTPCheck decodes the value of an http: item.
+func parseHTTPCheck(value interface{}) (HTTPCheck, error) {
+	var c HTTPCheck
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return c, err
+	}
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return c, fmt.Errorf("invalid http check: %v", err)
+	}
+	if c.URL == "" {
+		return c, fmt.Errorf("invalid http check: url is required")
+	}
+	for _, status := range c.Status {
+		if _, _, err := statusRange(status); err != nil {
+			return c, err
+		}
+	}
+	if c.Matches != "" {
+		if _, err := regexp.Compile(c.Matches); err != nil {
+			return c, fmt.Errorf("invalid http check: %v", err)
+		}
+	}
+	return c, nil
+}
+
+// expand replaces ${NAME} variables in the request and assertion strings.
+func (c HTTPCheck) expand(lookup func(string) (string, bool)) (HTTPCheck, error) {
+	var err error
+	expand := func(s string) string {
+		expanded, expandErr := process.Expand(s, lookup)
+		if err == nil {
+			err = expandErr
+		}
+		return expanded
+	}
+	c.URL = addDefaultProtocol(expand(c.URL))
+	c.Method = expand(c.Method)
+	c.Body = expand(c.Body)
+	c.Contains = expand(c.Contains)
+	headers := make(map[string]string, len(c.Headers))
+	for name, value := range c.Headers {
+		headers[name] = expand(value)
+	}
+	c.Headers = headers
+	c.TLS.CA, c.TLS.Cert, c.TLS.Key = expand(c.TLS.CA), expand(c.TLS.Cert), expand(c.TLS.Key)
+	return c, err
+}
+
+// client builds the HTTP client of the check.
+func (c HTTPCheck) client() (*http.Client, error) {
+	tlsConfig := &tls.Config{ServerName: c.TLS.ServerName, InsecureSkipVerify: c.TLS.InsecureSkipVerify}
+
+	if c.TLS.CA != "" {
+		pem, err := os.ReadFile(c.TLS.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file '%s'", c.TLS.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.TLS.Cert != "" || c.TLS.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.TLS.Cert, c.TLS.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	client := &http.Client{Transport: transport}
+	if c.FollowRedirects != nil && !*c.FollowRedirects {
+		client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	}
+	return client, nil
+}
+
+// evaluate sends the request and verifies the response. The request is
+// bounded by the timeout of the check, or by what is left until the scope
+// gives up if that is sooner.
+func (c HTTPCheck) evaluate(scope *Scope) error {
+	client, err := c.client()
+	if err != nil {
+		return err
+	}
+
+	timeout := c.Timeout
+	if timeout == 0 {
+		timeout = defaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), scope.attemptTimeout(timeout))
+	defer cancel()
+
+	method := strings.ToUpper(c.Method)
+	if method == "" {
+		method = http.MethodGet
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.URL, strings.NewReader(c.Body))
+	if err != nil {
+		return err
+	}
+	for name, value := range c.Headers {
+		req.Header.Set(name, value)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s %s failed: %v", method, c.URL, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHTTPBody))
+	if err != nil {
+		return fmt.Errorf("failed to read response of %s %s: %v", method, c.URL, err)
+	}
+
+	if !c.statusAccepted(resp.StatusCode) {
+		return fmt.Errorf("%s %s returned status %d, expected %s", method, c.URL, resp.StatusCode, c.statusDescription())
+	}
+
+	if c.Contains != "" && !strings.Contains(string(body), c.Contains) {
+		return fmt.Errorf("response of %s %s does not contain '%s'", method, c.URL, c.Contains)
+	}
+
+	if c.Matches != "" && !regexp.MustCompile(c.Matches).Match(body) {
+		return fmt.Errorf("response of %s %s does not match '%s'", method, c.URL, c.Matches)
+	}
+
+	if len(c.JSON) > 0 {
+		var doc interface{}
+		if err := json.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("response of %s %s is not JSON: %v", method, c.URL, err)
+		}
+		for path, expected := range c.JSON {
+			actual, err := lookupPath(doc, path)
+			if err != nil {
+				return fmt.Errorf("response of %s %s: %v", method, c.URL, err)
+			}
+			if !valuesEqual(actual, expected) {
+				return fmt.Errorf("response of %s %s has '%s' = %s, expected %s", method, c.URL, path, formatValue(actual), formatValue(expected))
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c HTTPCheck) statusAccepted(code int) bool {
+	if len(c.Status) == 0 {
+		return code >= 200 && code <= 299
+	}
+	for _, status := range c.Status {
+		if low, high, _ := statusRange(status); code >= low && code <= high {
+			return true
+		}
+	}
+	return false
+}
+
+func (c HTTPCheck) statusDescription() string {
+	if len(c.Status) == 0 {
+		return "2xx"
+	}
+	return strings.Join(c.Status, ", ")
+}
+
+// statusRange parses `204`, `2xx` or `200-299` into an inclusive range.
+func statusRange(status string) (int, int, error) {
+	status = strings.ToLower(strings.TrimSpace(status))
+	if len(status) == 3 && strings.HasSuffix(status, "xx") {
+		class, err := strconv.Atoi(status[:1])
+		if err == nil {
+			return class * 100, class*100 + 99, nil
+		}
+	}
+	if low, high, ok := strings.Cut(status, "-"); ok {
+		l, err1 := strconv.Atoi(strings.TrimSpace(low))
+		h, err2 := strconv.Atoi(strings.TrimSpace(high))
+		if err1 == nil && err2 == nil && l <= h {
+			return l, h, nil
+		}
+	} else if code, err := strconv.Atoi(status); err == nil {
+		return code, code, nil
+	}
+	return 0, 0, fmt.Errorf("invalid http check: invalid status '%s'", status)
+}
+
+// evaluateHTTP runs an http: item with the modifiers of its key.
+func evaluateHTTP(scope *Scope, cond condition, value interface{}) error {
+	c, err := parseHTTPCheck(value)
+	if err != nil {
+		return err
+	}
+	for key := range c.Retry {
+		if !contains(retryOptions, key) {
+			return fmt.Errorf("invalid http check: unknown retry option '%s'", key)
+		}
+		if !cond.persistent {
+			return fmt.Errorf("invalid http check: retry only applies to persistent (@http) checks")
+		}
+	}
+	policy, err := scope.retryPolicy().withOptions(c.Retry)
+	if err != nil {
+		return fmt.Errorf("invalid http check: %v", err)
+	}
+	if c, err = c.expand(scope.LookupEnv); err != nil {
+		return fmt.Errorf("invalid http check: %w", err)
+	}
+
+	persistent := cond.persistent && !scope.Once
+	if persistent && policy.Timeout > 0 {
+		attemptScope := *scope
+		attemptScope.deadline = time.Now().Add(policy.Timeout)
+		scope = &attemptScope
+	}
+	return retryCheck(func() error {
+		err := c.evaluate(scope)
+		if cond.negate {
+			if err == nil {
+				return fmt.Errorf("unexpected http check of '%s' passed", c.URL)
+			}
+			return nil
+		}
+		return err
+	}, persistent, policy, scope.done)
+}
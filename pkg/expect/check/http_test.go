@@ -0,0 +1,143 @@
+package check
+
+import (
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+func parseRule(t *testing.T, text string) interface{} {
+	var rule interface{}
+	if err := yaml.Unmarshal([]byte(text), &rule); err != nil {
+		t.Fatalf("failed to parse rule: %v", err)
+	}
+	return rule
+}
+
+func TestHTTPCheck(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"status": "up", "checks": [{"name": "db", "ok": true}], "uptime": 42}`)
+	})
+	mux.HandleFunc("/empty", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		w.Write(body)
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/health", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Setenv("TEST_TOKEN", "secret")
+
+	tests := []struct {
+		name        string
+		rule        string
+		expectError bool
+	}{
+		{"Default status", "http: {url: %s/health}", false},
+		{"Status class", "http: {url: %s/empty, status: 2xx}", false},
+		{"Status mismatch", "http: {url: %s/empty, status: 200}", true},
+		{"Status list", "http: {url: %s/empty, status: [200, 204]}", false},
+		{"Body substring", "http: {url: %s/health, contains: up}", false},
+		{"Body regex", "http: {url: %s/health, matches: '\"uptime\": \\d+'}", false},
+		{"Body regex mismatch", "http: {url: %s/health, matches: 'down'}", true},
+		{"JSON paths", "http: {url: %s/health, json: {status: up, 'checks[0].name': db, 'checks[0].ok': true, uptime: 42}}", false},
+		{"JSON mismatch", "http: {url: %s/health, json: {status: down}}", true},
+		{"JSON missing path", "http: {url: %s/health, json: {missing.key: 1}}", true},
+		{"Method, headers and body", "http: {url: %s/echo, method: post, headers: {Authorization: 'Bearer ${TEST_TOKEN}'}, body: pong, contains: pong}", false},
+		{"Unauthorized", "http: {url: %s/echo, method: post}", true},
+		{"Redirects are followed", "http: {url: %s/moved, contains: up}", false},
+		{"Redirects not followed", "http: {url: %s/moved, follow_redirects: false, status: 302}", false},
+		{"Negated", "'!http': {url: %s/empty, status: 200}", false},
+		{"Negated failure", "'!http': {url: %s/health}", true},
+		{"Persistent", "'@http': {url: %s/empty, status: 200, retry: {attempts: 2, interval: 10ms}}", true},
+		{"Retry without persistence", "http: {url: %s/health, retry: {attempts: 2}}", true},
+		{"Unknown field", "http: {url: %s/health, colour: red}", true},
+		{"Invalid status", "http: {url: %s/health, status: 2x}", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := parseRule(t, fmt.Sprintf(tt.rule, server.URL))
+			err := EvaluateRules(&Scope{}, []interface{}{rule})
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestHTTPAttemptsAreBounded(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	for _, rule := range []string{
+		"http: {url: %s, timeout: 200ms}",
+		"'@http': {url: %s, timeout: 1m, retry: {timeout: 200ms}}",
+	} {
+		start := time.Now()
+		if err := EvaluateRules(&Scope{}, []interface{}{parseRule(t, fmt.Sprintf(rule, server.URL))}); err == nil {
+			t.Errorf("%s: expected error, got none", rule)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: expected the request to stop after about 200ms, took %s", rule, elapsed)
+		}
+	}
+}
+
+func TestHTTPCheckTLS(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "secure")
+	}))
+	defer server.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := os.WriteFile(caFile, certPEM, 0644); err != nil {
+		t.Fatalf("failed to write CA file: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		rule        string
+		expectError bool
+	}{
+		{"Unknown CA", "http: {url: %s}", true},
+		{"Custom CA", "http: {url: %s, contains: secure, tls: {ca: " + caFile + "}}", false},
+		{"Skip verify", "http: {url: %s, tls: {insecure_skip_verify: true}}", false},
+		{"Missing client certificate", "http: {url: %s, tls: {ca: " + caFile + ", cert: missing.pem, key: missing.key}}", true},
+		{"Timeout", "http: {url: %s, timeout: 1ns, tls: {insecure_skip_verify: true}}", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := parseRule(t, fmt.Sprintf(tt.rule, server.URL))
+			err := EvaluateRules(&Scope{}, []interface{}{rule})
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
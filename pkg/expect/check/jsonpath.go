@@ -0,0 +1,81 @@
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// lookupPath finds the value at a dotted path such as `data.items[0].name`
+// in a decoded JSON or YAML document. A leading `$` or `$.` is optional and an
+// empty path returns the document itself.
+func lookupPath(doc interface{}, path string) (interface{}, error) {
+	path = strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if path == "" {
+		return doc, nil
+	}
+
+	current := doc
+	for _, segment := range pathSegments(path) {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("path '%s': key '%s' not found", path, segment)
+			}
+			current = value
+		case map[interface{}]interface{}:
+			value, ok := node[segment]
+			if !ok {
+				return nil, fmt.Errorf("path '%s': key '%s' not found", path, segment)
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, fmt.Errorf("path '%s': '%s' is not an index", path, segment)
+			}
+			if index < 0 {
+				index += len(node)
+			}
+			if index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("path '%s': index %s out of range", path, segment)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("path '%s': cannot look up '%s' in %T", path, segment, current)
+		}
+	}
+	return current, nil
+}
+
+// pathSegments splits `a.b[0].c` into `a`, `b`, `0`, `c`.
+func pathSegments(path string) []string {
+	path = strings.NewReplacer("[", ".", "]", "").Replace(path)
+	var segments []string
+	for _, segment := range strings.Split(path, ".") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// valuesEqual compares a value found in a document with an expected value
+// written in YAML, so that 3 matches 3.0 and "true" matches true.
+func valuesEqual(actual, expected interface{}) bool {
+	return formatValue(actual) == formatValue(expected)
+}
+
+func formatValue(v interface{}) string {
+	switch value := v.(type) {
+	case nil:
+		return "null"
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(value), 'f', -1, 32)
+	default:
+		return fmt.Sprint(value)
+	}
+}
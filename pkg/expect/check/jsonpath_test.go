@@ -0,0 +1,38 @@
+package check
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestLookupPath(t *testing.T) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(`{"a": {"b": [1, {"c": "d"}]}, "n": null}`), &doc); err != nil {
+		t.Fatalf("failed to parse document: %v", err)
+	}
+
+	tests := []struct {
+		path        string
+		expected    interface{}
+		expectError bool
+	}{
+		{path: "a.b[0]", expected: 1},
+		{path: "$.a.b[1].c", expected: "d"},
+		{path: "a.b.-1.c", expected: "d"},
+		{path: "n", expected: nil},
+		{path: "a.x", expectError: true},
+		{path: "a.b[5]", expectError: true},
+		{path: "a.b.c", expectError: true},
+	}
+
+	for _, tt := range tests {
+		value, err := lookupPath(doc, tt.path)
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.path, tt.expectError, err)
+			continue
+		}
+		if !tt.expectError && !valuesEqual(value, tt.expected) {
+			t.Errorf("%s: expected %v, got %v", tt.path, tt.expected, value)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package check
+
+import (
+	"regexp"
+	"strings"
+)
+
+// ansiPattern matches terminal escape sequences: CSI sequences such as
+// colours and cursor movements, OSC sequences such as hyperlinks and window
+// titles, and two character escapes.
+var ansiPattern = regexp.MustCompile(`\x1b\[[0-?]*[ -/]*[@-~]|\x1b\][^\x07\x1b]*(?:\x07|\x1b\\)|\x1b[@-Z\\-_]`)
+
+// spacePattern matches runs of spaces and tabs.
+var spacePattern = regexp.MustCompile(`[ \t]+`)
+
+// Normalization is how output is cleaned up before expectations match it.
+// The zero value leaves output untouched.
+type Normalization struct {
+	// StripANSI removes colours and other terminal escape sequences.
+	StripANSI bool
+	// CollapseProgress keeps the last update of lines redrawn with a
+	// carriage return, such as progress bars.
+	CollapseProgress bool
+	// LineEndings turns \r\n line endings into \n.
+	LineEndings bool
+	// FoldWhitespace turns runs of spaces and tabs into a single space and
+	// trims the end of lines.
+	FoldWhitespace bool
+}
+
+// DefaultNormalization strips escape sequences, collapses progress updates
+// and normalizes line endings, but keeps whitespace.
+func DefaultNormalization() Normalization {
+	return Normalization{StripANSI: true, CollapseProgress: true, LineEndings: true}
+}
+
+// Apply returns the normalized output.
+func (n Normalization) Apply(output string) string {
+	if n.StripANSI && strings.Contains(output, "\x1b") {
+		output = ansiPattern.ReplaceAllString(output, "")
+	}
+	if n.LineEndings {
+		output = strings.ReplaceAll(output, "\r\n", "\n")
+	}
+	if n.CollapseProgress && strings.Contains(output, "\r") {
+		lines := strings.Split(output, "\n")
+		for i, line := range lines {
+			lines[i] = lastUpdate(line)
+		}
+		output = strings.Join(lines, "\n")
+	}
+	if n.FoldWhitespace {
+		lines := strings.Split(output, "\n")
+		for i, line := range lines {
+			lines[i] = strings.TrimRight(spacePattern.ReplaceAllString(line, " "), " ")
+		}
+		output = strings.Join(lines, "\n")
+	}
+	return output
+}
+
+// lastUpdate returns what a terminal shows of a line redrawn with carriage
+// returns: its last non-empty update.
+func lastUpdate(line string) string {
+	updates := strings.Split(line, "\r")
+	for i := len(updates) - 1; i > 0; i-- {
+		if updates[i] != "" {
+			return updates[i]
+		}
+	}
+	return updates[0]
+}
+
+// output is the whole output, normalized.
+func (s *Scope) output() string {
+	return s.Normalize.Apply(s.Output)
+}
@@ -0,0 +1,55 @@
+package check
+
+import (
+	"testing"
+)
+
+func TestNormalization(t *testing.T) {
+	all := Normalization{StripANSI: true, CollapseProgress: true, LineEndings: true, FoldWhitespace: true}
+
+	tests := []struct {
+		normalization Normalization
+		output        string
+		expected      string
+	}{
+		{Normalization{}, "\x1b[32mok\x1b[0m\r\n", "\x1b[32mok\x1b[0m\r\n"},
+		{DefaultNormalization(), "\x1b[1;32mPASS\x1b[0m: TestA\r\n", "PASS: TestA\n"},
+		{DefaultNormalization(), "\x1b]8;;https://example.com\x07link\x1b]8;;\x07 \x1b[2K\x1b[1Gdone\n", "link done\n"},
+		{DefaultNormalization(), "Pulling  10%\rPulling  55%\rPulling 100%\nDone\n", "Pulling 100%\nDone\n"},
+		{DefaultNormalization(), "Installing...\r\r\n", "Installing...\n"},
+		{DefaultNormalization(), "a  b\t c  \n", "a  b\t c  \n"},
+		{all, "a  b\t c  \n\x1b[31m x \x1b[0m\r\n", "a b c\n x\n"},
+		{Normalization{CollapseProgress: true}, "50%\r100%\n", "100%\n"},
+	}
+
+	for _, tt := range tests {
+		if actual := tt.normalization.Apply(tt.output); actual != tt.expected {
+			t.Errorf("%q: expected %q, got %q", tt.output, tt.expected, actual)
+		}
+	}
+}
+
+func TestOutputIsNormalizedBeforeMatching(t *testing.T) {
+	output := "\x1b[32m✓\x1b[0m build\r\nProgress 10%\rProgress 100%\r\n"
+
+	tests := []struct {
+		normalization Normalization
+		expectation   string
+		expectError   bool
+	}{
+		{DefaultNormalization(), "LINE:Progress 100%", false},
+		{DefaultNormalization(), "TEXT:✓ build", false},
+		{DefaultNormalization(), "LINES:2", false},
+		{DefaultNormalization(), "RE:(?m)^✓ build$", false},
+		{Normalization{}, "LINE:Progress 100%", true},
+		{Normalization{}, "TEXT:✓ build", true},
+	}
+
+	for _, tt := range tests {
+		scope := &Scope{Output: output, StepOutput: output, Normalize: tt.normalization}
+		err := Evaluate(scope, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// stepOutput is the output structured assertions read: the output of the
+// step when it is known, the whole output otherwise. It is normalized.
+func (s *Scope) stepOutput() string {
+	if s.HasStepOutput || s.StepOutput != "" {
+		return s.Normalize.Apply(s.StepOutput)
+	}
+	return s.output()
+}
+
+// parseText builds the TEXT: checker condition, which searches the whole output.
+func parseText(text string, options map[string]string) (Condition, error) {
+	sensitive, err := boolOption(options, "case_sensitive")
+	if err != nil {
+		return nil, err
+	}
+	return textCondition(text, sensitive), nil
+}
+
+// textCondition looks for the text in the output, ignoring case unless asked not to.
+func textCondition(text string, caseSensitive bool) Condition {
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		output, want := scope.output(), text
+		if !caseSensitive {
+			output, want = strings.ToLower(output), strings.ToLower(want)
+		}
+		found := strings.Contains(output, want)
+		if negate && found {
+			return fmt.Errorf("unexpected output: found '%s'", text)
+		}
+		if !negate && !found {
+			return fmt.Errorf("expected '%s' not found in output", text)
+		}
+		return nil
+	})
+}
+
+// parseLine builds the LINE: condition, which looks for a line of the step output that equals the text.
+func parseLine(text string, options map[string]string) (Condition, error) {
+	sensitive, err := boolOption(options, "case_sensitive")
+	if err != nil {
+		return nil, err
+	}
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		found := false
+		for _, line := range outputLines(scope.stepOutput()) {
+			if line == text || (!sensitive && strings.EqualFold(line, text)) {
+				found = true
+				break
+			}
+		}
+		if negate && found {
+			return fmt.Errorf("unexpected line '%s' found in output", text)
+		}
+		if !negate && !found {
+			return fmt.Errorf("expected line '%s' not found in output", text)
+		}
+		return nil
+	}), nil
+}
+
+// parseLineCount builds the LINES: condition, which compares the number of
+// lines of the step output, i.e. `LINES:>=3`.
+func parseLineCount(arg string, options map[string]string) (Condition, error) {
+	_, op, want, ok := splitComparison(arg)
+	if !ok {
+		op, want = "==", arg
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(want))
+	if err != nil {
+		return nil, fmt.Errorf("invalid LINES condition '%s'", arg)
+	}
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		count := len(outputLines(scope.stepOutput()))
+		holds := compareOrdered(count-n, op)
+		if negate && holds {
+			return fmt.Errorf("unexpected line count %d %s %d", count, op, n)
+		}
+		if !negate && !holds {
+			return fmt.Errorf("expected line count %s %d, got %d", op, n, count)
+		}
+		return nil
+	}), nil
+}
+
+// outputLines splits output into lines, ignoring the final line break.
+func outputLines(output string) []string {
+	output = strings.TrimSuffix(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	if output == "" {
+		return nil
+	}
+	return strings.Split(output, "\n")
+}
+
+// parseRegex builds the RE: condition, which matches the step output against
+// a regular expression and exports its named capture groups as environment variables.
+func parseRegex(pattern string, options map[string]string) (Condition, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RE pattern '%s': %v", pattern, err)
+	}
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		match := re.FindStringSubmatch(scope.stepOutput())
+		if negate {
+			if match != nil {
+				return fmt.Errorf("unexpected output: matched '%s'", pattern)
+			}
+			return nil
+		}
+		if match == nil {
+			return fmt.Errorf("expected output to match '%s'", pattern)
+		}
+
+		for i, name := range re.SubexpNames() {
+			if name == "" || scope.Export == nil {
+				continue
+			}
+			if err := scope.Export(name, match[i]); err != nil {
+				return fmt.Errorf("failed to export '%s': %v", name, err)
+			}
+		}
+		return nil
+	}), nil
+}
+
+// documentChecker builds the JSON: and YAML: checkers, which evaluate `path`,
+// or `path op value`, against the step output, i.e. `JSON:.status == "ready"`.
+func documentChecker(name string, unmarshal func([]byte, interface{}) error) *builtin {
+	return &builtin{
+		name:        name,
+		description: "evaluates a path of the step output parsed as " + name + ", optionally compared to a value",
+		output:      true,
+		parse: func(arg string, options map[string]string) (Condition, error) {
+			path, op, want, hasOp := splitComparison(arg)
+			var expected interface{}
+			if hasOp {
+				if err := yaml.Unmarshal([]byte(want), &expected); err != nil {
+					return nil, fmt.Errorf("invalid value '%s' in %s condition: %v", want, name, err)
+				}
+			}
+
+			return ConditionFunc(func(scope *Scope, negate bool) error {
+				var doc interface{}
+				if err := unmarshal([]byte(scope.stepOutput()), &doc); err != nil {
+					return fmt.Errorf("output is not valid %s: %v", name, err)
+				}
+
+				actual, lookupErr := lookupPath(doc, path)
+				holds := lookupErr == nil && (!hasOp || compareValues(actual, op, expected))
+
+				if negate && holds {
+					return fmt.Errorf("unexpected %s output matches '%s'", name, arg)
+				}
+				if !negate && !holds {
+					if lookupErr != nil {
+						return fmt.Errorf("expected %s output to match '%s': %v", name, arg, lookupErr)
+					}
+					return fmt.Errorf("expected %s output to match '%s', got %s", name, arg, formatValue(actual))
+				}
+				return nil
+			}), nil
+		},
+	}
+}
+
+// compareValues compares a document value with an expected value. Ordering
+// operators compare numbers numerically and everything else as text.
+func compareValues(actual interface{}, op string, expected interface{}) bool {
+	switch op {
+	case "==":
+		return valuesEqual(actual, expected)
+	case "!=":
+		return !valuesEqual(actual, expected)
+	}
+	a, errA := parseNumber(formatValue(actual))
+	b, errB := parseNumber(formatValue(expected))
+	if errA == nil && errB == nil {
+		return compareNumbers(a, op, b)
+	}
+	return compareOrdered(strings.Compare(formatValue(actual), formatValue(expected)), op)
+}
@@ -0,0 +1,107 @@
+package check
+
+import (
+	"testing"
+)
+
+func TestOutputMatchers(t *testing.T) {
+	jsonOutput := `{"status": "ready", "replicas": 3, "items": [{"name": "web"}], "ok": true}`
+	yamlOutput := "status: ready\nitems:\n  - name: web\n    port: 8080\n"
+	textOutput := "Starting\nListening on :8080\nReady\n"
+
+	tests := []struct {
+		output      string
+		expectation string
+		expectError bool
+	}{
+		{jsonOutput, `JSON:.status == "ready"`, false},
+		{jsonOutput, `JSON:.status == ready`, false},
+		{jsonOutput, `JSON:.status != "ready"`, true},
+		{jsonOutput, `JSON:.replicas >= 2`, false},
+		{jsonOutput, `JSON:.replicas > 3`, true},
+		{jsonOutput, `JSON:.items[0].name == web`, false},
+		{jsonOutput, `JSON:.ok == true`, false},
+		{jsonOutput, `JSON:.missing`, true},
+		{jsonOutput, `!JSON:.missing`, false},
+		{jsonOutput, `JSON:.items`, false},
+		{textOutput, `JSON:.status`, true},
+		{yamlOutput, `YAML:.items[0].port == 8080`, false},
+		{yamlOutput, `YAML:status == pending`, true},
+		{textOutput, `RE:Listening on :\d+`, false},
+		{textOutput, `RE:^Ready$`, true},
+		{textOutput, `RE:(?m)^Ready$`, false},
+		{textOutput, `!RE:(?i)error`, false},
+		{textOutput, `RE:[`, true},
+		{textOutput, `LINE:Ready`, false},
+		{textOutput, `LINE:ready`, false},
+		{textOutput, `LINE[case_sensitive=true]:ready`, true},
+		{textOutput, `LINE:Listening`, true},
+		{textOutput, `!LINE:Stopped`, false},
+		{textOutput, `LINES:3`, false},
+		{textOutput, `LINES:>=4`, true},
+		{textOutput, `LINES:<10`, false},
+		{textOutput, `LINES:many`, true},
+		{textOutput, `TEXT:listening`, false},
+		{textOutput, `TEXT[case_sensitive=true]:listening`, true},
+		{textOutput, `!TEXT[case_sensitive=true]:listening`, false},
+		{textOutput, `TEXT[case_sensitive=maybe]:listening`, true},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(&Scope{Output: tt.output, StepOutput: tt.output}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+}
+
+func TestSilentStepOutput(t *testing.T) {
+	// Earlier steps printed output, the step itself printed nothing
+	earlier := "Ready\n{\"status\": \"ready\"}\n"
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{`LINES:0`, false},
+		{`LINES:>=1`, true},
+		{`RE:Ready`, true},
+		{`!RE:Ready`, false},
+		{`LINE:Ready`, true},
+		{`!LINE:Ready`, false},
+		{`JSON:.status`, true},
+		{`YAML:status`, true},
+		{`TEXT:Ready`, false},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(&Scope{Output: earlier, HasStepOutput: true}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	// Without a known step output, the whole output is read
+	if err := Evaluate(&Scope{Output: earlier}, []string{`LINE:Ready`}); err != nil {
+		t.Errorf("expected the whole output to be read, got %v", err)
+	}
+}
+
+func TestRegexExportsCaptureGroups(t *testing.T) {
+	exported := make(map[string]string)
+	scope := &Scope{
+		StepOutput: "helm version v3.14.2 (commit abc123)",
+		Export: func(name, value string) error {
+			exported[name] = value
+			return nil
+		},
+	}
+
+	err := Evaluate(scope, []string{`RE:version v(?P<HELM_VERSION>[\d.]+) \(commit (?P<HELM_COMMIT>\w+)\)`})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exported["HELM_VERSION"] != "3.14.2" || exported["HELM_COMMIT"] != "abc123" {
+		t.Errorf("unexpected exported variables: %v", exported)
+	}
+}
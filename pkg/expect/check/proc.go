@@ -0,0 +1,177 @@
+package check
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// psCommand lists the processes where /proc is not available.
+const psCommand = "ps -A -o pid= -o ppid= -o comm= -o args="
+
+// procInfo is a running process as seen by PROC: checks.
+type procInfo struct {
+	pid     int
+	ppid    int
+	comm    string
+	cmdline string
+}
+
+// parseProc builds the PROC: condition. It holds when a process has the name,
+// or a command line matching the regular expression. Runner and the processes
+// that started it are left out, since their command lines contain the pattern.
+func parseProc(pattern string, options map[string]string) (Condition, error) {
+	if pattern == "" {
+		return nil, fmt.Errorf("missing process name")
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid process pattern '%s': %v", pattern, err)
+	}
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		procs, err := listProcesses(scope)
+		if err != nil {
+			return err
+		}
+
+		var ancestors map[int]bool
+		if scope.Remote == nil {
+			ancestors = ancestorPIDs(procs, os.Getpid())
+		}
+
+		var found *procInfo
+		for i, p := range procs {
+			if ancestors[p.pid] {
+				continue
+			}
+			if p.comm == pattern || re.MatchString(p.cmdline) {
+				found = &procs[i]
+				break
+			}
+		}
+
+		if negate && found != nil {
+			return fmt.Errorf("unexpected process '%s' is running (pid %d)", pattern, found.pid)
+		}
+		if !negate && found == nil {
+			return fmt.Errorf("expected process '%s' is not running", pattern)
+		}
+		return nil
+	}), nil
+}
+
+// parsePID builds the PID: condition. It holds when the pid file exists and
+// the process it names is alive.
+func parsePID(pidFile string, options map[string]string) (Condition, error) {
+	if pidFile == "" {
+		return nil, fmt.Errorf("missing pid file")
+	}
+
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		pid, err := pidAlive(scope, pidFile)
+		if negate && err == nil {
+			return fmt.Errorf("unexpected process %d of pid file '%s' is running", pid, pidFile)
+		}
+		if !negate && err != nil {
+			return fmt.Errorf("expected process of pid file '%s' is not running: %v", pidFile, err)
+		}
+		return nil
+	}), nil
+}
+
+// pidAlive reads the pid file and checks that its process is alive.
+func pidAlive(scope *Scope, pidFile string) (int, error) {
+	content, err := readFile(scope, pidFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, fmt.Errorf("pid file does not exist")
+		}
+		return 0, err
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil || pid <= 0 {
+		return 0, fmt.Errorf("pid file does not contain a pid")
+	}
+
+	if scope.Remote != nil {
+		alive, _, err := scope.runRemote("kill -0 " + strconv.Itoa(pid))
+		if err != nil {
+			return pid, err
+		}
+		if !alive {
+			return pid, fmt.Errorf("process %d is not alive", pid)
+		}
+		return pid, nil
+	}
+	if !processAlive(pid) {
+		return pid, fmt.Errorf("process %d is not alive", pid)
+	}
+	return pid, nil
+}
+
+// ancestorPIDs returns the pid and the pids of all its parents.
+func ancestorPIDs(procs []procInfo, pid int) map[int]bool {
+	parents := make(map[int]int, len(procs))
+	for _, p := range procs {
+		parents[p.pid] = p.ppid
+	}
+	ancestors := make(map[int]bool)
+	for pid > 0 && !ancestors[pid] {
+		ancestors[pid] = true
+		pid = parents[pid]
+	}
+	return ancestors
+}
+
+// listProcesses lists the processes, on the remote host of the scope if any.
+func listProcesses(scope *Scope) ([]procInfo, error) {
+	if scope.Remote == nil {
+		return localProcesses()
+	}
+	ok, out, err := scope.runRemote(psCommand)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, fmt.Errorf("failed to list processes on the remote host: %s", strings.TrimSpace(out))
+	}
+	return parsePS(out), nil
+}
+
+// parsePS parses the output of psCommand.
+func parsePS(out string) []procInfo {
+	var procs []procInfo
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		pid, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		ppid, _ := strconv.Atoi(fields[1])
+		// Some ps implementations print the full path of the executable as comm
+		p := procInfo{pid: pid, ppid: ppid, comm: filepath.Base(fields[2])}
+		if len(fields) > 3 {
+			p.cmdline = strings.Join(fields[3:], " ")
+		}
+		procs = append(procs, p)
+	}
+	return procs
+}
+
+// runPS lists the local processes with ps.
+func runPS() ([]procInfo, error) {
+	result := <-runnerexec.Execute(runnerexec.LocalExecutor{}, runnerexec.Command{Exec: psCommand}, nil)
+	if result.Err != nil {
+		return nil, fmt.Errorf("failed to list processes: %v", result.Err)
+	}
+	return parsePS(result.Output), nil
+}
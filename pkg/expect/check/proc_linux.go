@@ -0,0 +1,67 @@
+package check
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// localProcesses lists the processes from /proc, leaving out zombies.
+func localProcesses() ([]procInfo, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return runPS()
+	}
+
+	var procs []procInfo
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		ppid, alive := processStat(pid)
+		if !alive {
+			continue
+		}
+		dir := filepath.Join("/proc", entry.Name())
+		comm, err := os.ReadFile(filepath.Join(dir, "comm"))
+		if err != nil {
+			continue
+		}
+		cmdline, _ := os.ReadFile(filepath.Join(dir, "cmdline"))
+		procs = append(procs, procInfo{
+			pid:     pid,
+			ppid:    ppid,
+			comm:    strings.TrimSpace(string(comm)),
+			cmdline: strings.TrimSpace(string(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '}))),
+		})
+	}
+	return procs, nil
+}
+
+// processAlive reports whether the process exists and is not a zombie.
+func processAlive(pid int) bool {
+	_, alive := processStat(pid)
+	return alive
+}
+
+// processStat reads the parent pid of a process, and whether it exists and is not a zombie.
+func processStat(pid int) (int, bool) {
+	stat, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return 0, false
+	}
+	// The state and parent pid follow the command name, which is in parentheses and may contain spaces
+	end := bytes.LastIndexByte(stat, ')')
+	if end == -1 {
+		return 0, true
+	}
+	fields := strings.Fields(string(stat[end+1:]))
+	if len(fields) < 2 {
+		return 0, true
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	return ppid, fields[0] != "Z" && fields[0] != "X"
+}
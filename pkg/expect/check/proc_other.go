@@ -0,0 +1,28 @@
+//go:build !linux
+
+package check
+
+import (
+	"errors"
+	"os"
+	"runtime"
+	"syscall"
+)
+
+// localProcesses lists the processes with ps.
+func localProcesses() ([]procInfo, error) {
+	return runPS()
+}
+
+// processAlive reports whether the process exists.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	err = p.Signal(syscall.Signal(0))
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
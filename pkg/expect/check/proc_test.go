@@ -0,0 +1,86 @@
+package check
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestProcAndPIDChecks(t *testing.T) {
+	cmd := exec.Command("sleep", "37.25")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "sleep.pid")
+	if err := os.WriteFile(pidFile, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatalf("failed to write pid file: %v", err)
+	}
+	invalidFile := filepath.Join(dir, "invalid.pid")
+	if err := os.WriteFile(invalidFile, []byte("not a pid"), 0644); err != nil {
+		t.Fatalf("failed to write pid file: %v", err)
+	}
+
+	running := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"PROC:sleep", false},
+		{`PROC:^sleep 37\.25$`, false},
+		{`!PROC:^sleep 37\.25$`, true},
+		{"PROC:no-such-process-name", true},
+		{"!PROC:no-such-process-name", false},
+		{"PROC:[", true},
+		{"PID:" + pidFile, false},
+		{"!PID:" + pidFile, true},
+		{"PID:" + filepath.Join(dir, "missing.pid"), true},
+		{"!PID:" + filepath.Join(dir, "missing.pid"), false},
+		{"PID:" + invalidFile, true},
+	}
+	for _, tt := range running {
+		err := Evaluate(&Scope{}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+
+	stopped := []struct {
+		expectation string
+		expectError bool
+	}{
+		{`PROC:^sleep 37\.25$`, true},
+		{`!PROC:^sleep 37\.25$`, false},
+		{"PID:" + pidFile, true},
+		{"!@PID[timeout=5s,interval=100ms]:" + pidFile, false},
+	}
+	for _, tt := range stopped {
+		err := Evaluate(&Scope{}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+}
+
+func TestParsePS(t *testing.T) {
+	procs := parsePS("  1 0 /sbin/launchd /sbin/launchd\n 512 1 java java -cp kafka.jar kafka.Kafka config/server.properties\nbad line\n")
+	if len(procs) != 2 {
+		t.Fatalf("expected 2 processes, got %d", len(procs))
+	}
+	if procs[0].pid != 1 || procs[0].ppid != 0 || procs[0].comm != "launchd" {
+		t.Errorf("expected launchd with pid 1, got %+v", procs[0])
+	}
+	if procs[1].comm != "java" || procs[1].cmdline != "java -cp kafka.jar kafka.Kafka config/server.properties" {
+		t.Errorf("expected the java command line, got %+v", procs[1])
+	}
+
+	ancestors := ancestorPIDs(procs, 512)
+	if !ancestors[512] || !ancestors[1] || len(ancestors) != 2 {
+		t.Errorf("expected pids 512 and 1 as ancestors, got %v", ancestors)
+	}
+}
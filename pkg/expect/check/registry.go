@@ -0,0 +1,165 @@
+package check
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Checker handles one kind of prefixed condition, such as CMD in `CMD:git`.
+type Checker interface {
+	// Name is the prefix the checker handles, without the colon.
+	Name() string
+	// Describe explains what the check verifies in one line.
+	Describe() string
+	// Parse validates the argument and the options of a condition, which are
+	// written as `NAME[key=value,...]:arg`. Retry options never reach Parse.
+	Parse(arg string, options map[string]string) (Condition, error)
+}
+
+// Condition is a parsed check.
+type Condition interface {
+	// Evaluate returns nil when the condition holds against the scope, or,
+	// for a negated (`!`) condition, when it does not.
+	Evaluate(scope *Scope, negate bool) error
+}
+
+// ConditionFunc adapts a function to a Condition.
+type ConditionFunc func(scope *Scope, negate bool) error
+
+// Evaluate calls f(scope, negate).
+func (f ConditionFunc) Evaluate(scope *Scope, negate bool) error {
+	return f(scope, negate)
+}
+
+// validCheckName matches the names checkers can be registered under.
+var validCheckName = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_]*$`)
+
+var registry = struct {
+	mu       sync.RWMutex
+	checkers map[string]Checker
+}{checkers: make(map[string]Checker)}
+
+// Register makes a checker available under its name, replacing any checker
+// registered under the same name.
+func Register(checker Checker) error {
+	name := checker.Name()
+	if !validCheckName.MatchString(name) {
+		return fmt.Errorf("invalid check name '%s'", name)
+	}
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.checkers[name] = checker
+	return nil
+}
+
+// Lookup finds the checker of a prefix. Prefixes without a registered checker
+// are looked up as external `runner-check-<name>` executables in $PATH.
+func Lookup(name string) (Checker, bool) {
+	if !validCheckName.MatchString(name) {
+		return nil, false
+	}
+	registry.mu.RLock()
+	checker, ok := registry.checkers[name]
+	registry.mu.RUnlock()
+	if ok {
+		return checker, true
+	}
+	return lookupExternal(name)
+}
+
+// Checkers returns the registered checkers sorted by name.
+func Checkers() []Checker {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	checkers := make([]Checker, 0, len(registry.checkers))
+	for _, checker := range registry.checkers {
+		checkers = append(checkers, checker)
+	}
+	sort.Slice(checkers, func(i, j int) bool { return checkers[i].Name() < checkers[j].Name() })
+	return checkers
+}
+
+// HasCheckPrefix reports whether s starts with the prefix of a known check,
+// such as `CMD:`, `URL[timeout=5s]:` or `MEM>=`.
+func HasCheckPrefix(s string) bool {
+	end := strings.IndexAny(s, checkNameEnd)
+	if end == -1 {
+		return false
+	}
+	_, ok := Lookup(s[:end])
+	return ok
+}
+
+// ValidateCheck returns an error unless rule, with its modifiers, names a
+// known check the way evaluation parses it.
+func ValidateCheck(rule string) error {
+	_, rest := parseModifiers(rule)
+	if err := checkModifiers(rule, rest); err != nil {
+		return err
+	}
+	if !HasCheckPrefix(rest) {
+		return fmt.Errorf("unsupported check '%s'", rule)
+	}
+	return nil
+}
+
+// ChecksOutput reports whether an expectation matches the output or the exit
+// status of a step, such as `TEXT:`, `RE:`, quoted strings and numbers,
+// rather than the state of the host.
+func ChecksOutput(exp string) bool {
+	cond, rest := parseModifiers(exp)
+	if err := cond.parseCheck(rest); err != nil {
+		return false
+	}
+	if cond.checker == nil {
+		return true
+	}
+	b, ok := cond.checker.(*builtin)
+	return ok && b.output
+}
+
+// builtin is a checker that ships with runner.
+type builtin struct {
+	name        string
+	description string
+	// options are the options the check accepts besides the retry options.
+	options []string
+	// once marks checks that are never retried, because they cannot change while runner waits.
+	once bool
+	// output marks checks of the output of a step rather than of the host.
+	output bool
+	// effects marks checks that run commands, write files or export variables,
+	// which a later condition of the same list may depend on.
+	effects bool
+	parse   func(arg string, options map[string]string) (Condition, error)
+}
+
+func (b *builtin) Name() string     { return b.name }
+func (b *builtin) Describe() string { return b.description }
+
+func (b *builtin) Parse(arg string, options map[string]string) (Condition, error) {
+	for key := range options {
+		if !contains(b.options, key) {
+			return nil, fmt.Errorf("unknown option '%s' for %s check", key, b.name)
+		}
+	}
+	return b.parse(arg, options)
+}
+
+// retries reports whether persistent conditions of the checker are retried.
+func retries(checker Checker) bool {
+	if b, ok := checker.(*builtin); ok {
+		return !b.once
+	}
+	return true
+}
+
+// mustRegister registers a builtin checker.
+func mustRegister(b *builtin) {
+	if err := Register(b); err != nil {
+		panic(err)
+	}
+}
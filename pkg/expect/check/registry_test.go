@@ -0,0 +1,108 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// evenChecker is a custom check that holds for even numbers.
+type evenChecker struct{}
+
+func (evenChecker) Name() string     { return "EVEN" }
+func (evenChecker) Describe() string { return "checks if a number is even" }
+
+func (evenChecker) Parse(arg string, options map[string]string) (Condition, error) {
+	var n int
+	if _, err := fmt.Sscan(arg, &n); err != nil {
+		return nil, fmt.Errorf("'%s' is not a number", arg)
+	}
+	return ConditionFunc(func(scope *Scope, negate bool) error {
+		if (n%2 == 0) == negate {
+			return fmt.Errorf("unexpected parity of %d", n)
+		}
+		return nil
+	}), nil
+}
+
+func TestRegister(t *testing.T) {
+	if err := Register(evenChecker{}); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer func() {
+		registry.mu.Lock()
+		delete(registry.checkers, "EVEN")
+		registry.mu.Unlock()
+	}()
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"EVEN:4", false},
+		{"EVEN:3", true},
+		{"!EVEN:3", false},
+		{"EVEN:four", true},
+		{"@EVEN[attempts=1]:3", true},
+	}
+	for _, tt := range tests {
+		err := Evaluate(&Scope{}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	if !HasCheckPrefix("EVEN:2") || !HasCheckPrefix("CMD[attempts=2]:go") {
+		t.Errorf("expected registered prefixes to be recognized")
+	}
+	if HasCheckPrefix("ODD:2") || HasCheckPrefix("just text") {
+		t.Errorf("expected unknown prefixes not to be recognized")
+	}
+
+	var names []string
+	for _, checker := range Checkers() {
+		names = append(names, checker.Name())
+	}
+	if !strings.Contains(strings.Join(names, ","), "CMD,DIR,DISK,ENV,EVEN,EXEC") {
+		t.Errorf("expected sorted checkers, got %v", names)
+	}
+}
+
+func TestRegisterInvalidName(t *testing.T) {
+	for _, name := range []string{"", "1ST", "WITH SPACE", "COLON:"} {
+		if err := Register(&builtin{name: name}); err == nil {
+			t.Errorf("%q: expected error, got none", name)
+		}
+	}
+}
+
+func TestChecksOutput(t *testing.T) {
+	tests := []struct {
+		expectation string
+		output      bool
+	}{
+		{"TEXT:ready", true},
+		{"!LINE:error", true},
+		{"LINES:>=3", true},
+		{"RE:^ok$", true},
+		{"GOLDEN:testdata/expected.txt", true},
+		{"JSON:.status == \"ready\"", true},
+		{"YAML:.items", true},
+		{"\"ready\"", true},
+		{"0", true},
+		{"Error: plain text", true},
+		{"CMD:go>=1.22", false},
+		{"@TCP:localhost:5432", false},
+		{"ENV:HOME", false},
+		{"FILE:/etc/hosts", false},
+		{"URL[timeout=5s]:localhost", false},
+		{"EXEC:true", false},
+		{"CMD[unknown=1]:go", false},
+	}
+
+	for _, tt := range tests {
+		if output := ChecksOutput(tt.expectation); output != tt.output {
+			t.Errorf("%s: expected %v, got %v", tt.expectation, tt.output, output)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/expect/process"
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// RetryPolicy bounds how long persistent (`@`) conditions are retried.
+type RetryPolicy struct {
+	// Timeout is how long to keep retrying. Zero retries without a time limit.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Interval is the delay between two attempts.
+	Interval time.Duration `mapstructure:"interval"`
+	// Attempts is the maximum number of attempts. Zero allows any number.
+	Attempts int `mapstructure:"attempts"`
+	// Backoff multiplies the interval after every failed attempt. Values up
+	// to 1 keep the interval constant.
+	Backoff float64 `mapstructure:"backoff"`
+}
+
+// minRetryInterval keeps persistent conditions with a zero interval from busy looping.
+const minRetryInterval = 100 * time.Millisecond
+
+var (
+	retryMu            sync.RWMutex
+	defaultRetryPolicy = RetryPolicy{Timeout: 5 * time.Minute, Interval: 2 * time.Second, Backoff: 1}
+)
+
+// DefaultRetryPolicy returns the policy used by persistent conditions that do not set their own.
+func DefaultRetryPolicy() RetryPolicy {
+	retryMu.RLock()
+	defer retryMu.RUnlock()
+	return defaultRetryPolicy
+}
+
+// SetDefaultRetryPolicy sets the policy used by persistent conditions that do not set their own.
+func SetDefaultRetryPolicy(policy RetryPolicy) {
+	retryMu.Lock()
+	defer retryMu.Unlock()
+	defaultRetryPolicy = policy
+}
+
+// Logf receives progress messages of persistent conditions. It discards them by default.
+var Logf = func(format string, args ...interface{}) {}
+
+// retryOptions are the condition options that configure the retry policy.
+var retryOptions = []string{"timeout", "interval", "attempts", "backoff"}
+
+// withOptions returns the policy with the retry options of a condition applied.
+func (p RetryPolicy) withOptions(options map[string]string) (RetryPolicy, error) {
+	for key, value := range options {
+		var err error
+		switch key {
+		case "timeout":
+			p.Timeout, err = time.ParseDuration(value)
+		case "interval":
+			p.Interval, err = time.ParseDuration(value)
+		case "attempts":
+			p.Attempts, err = strconv.Atoi(value)
+		case "backoff":
+			p.Backoff, err = strconv.ParseFloat(value, 64)
+		default:
+			continue
+		}
+		if err != nil {
+			return p, fmt.Errorf("invalid %s '%s': %v", key, value, err)
+		}
+	}
+	return p, nil
+}
+
+// retryCheck runs the check once, or, if persistent, until it passes, the
+// policy gives up or done is closed.
+func retryCheck(checkFunc func() error, persistent bool, policy RetryPolicy, done <-chan struct{}) error {
+	if !persistent {
+		return checkFunc()
+	}
+
+	start := time.Now()
+	interval := max(policy.Interval, minRetryInterval)
+	for attempt := 1; ; attempt++ {
+		err := checkFunc()
+		if err == nil || errors.Is(err, runnerexec.ErrDryRun) || isExpandError(err) {
+			return err
+		}
+
+		elapsed := time.Since(start)
+		if (policy.Attempts > 0 && attempt >= policy.Attempts) || (policy.Timeout > 0 && elapsed >= policy.Timeout) {
+			return fmt.Errorf("gave up after %s and %d attempts: %w", elapsed.Round(time.Millisecond), attempt, err)
+		}
+
+		// Never sleep past the deadline, the last attempt happens right at it
+		wait := interval
+		if policy.Timeout > 0 && policy.Timeout-elapsed < wait {
+			wait = policy.Timeout - elapsed
+		}
+		Logf("attempt %d failed: %v, retrying in %s", attempt, err, wait.Round(time.Millisecond))
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-done:
+			timer.Stop()
+			return errCanceled
+		}
+
+		if policy.Backoff > 1 {
+			interval = time.Duration(float64(interval) * policy.Backoff)
+		}
+	}
+}
+
+// isExpandError reports whether err comes from a placeholder that failed to
+// expand, which no further attempt can fix.
+func isExpandError(err error) bool {
+	var expandErr *process.ExpandError
+	return errors.As(err, &expandErr)
+}
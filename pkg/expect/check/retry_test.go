@@ -0,0 +1,136 @@
+package check
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/expect/process"
+)
+
+func TestRetryCheck(t *testing.T) {
+	failing := func(calls *int) func() error {
+		return func() error {
+			*calls++
+			return errors.New("not ready")
+		}
+	}
+
+	t.Run("Non-persistent checks run once", func(t *testing.T) {
+		calls := 0
+		err := retryCheck(failing(&calls), false, RetryPolicy{Interval: time.Millisecond, Attempts: 5}, nil)
+		if err == nil || err.Error() != "not ready" {
+			t.Fatalf("expected the check error, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 attempt, got %d", calls)
+		}
+	})
+
+	t.Run("Persistent checks stop after max attempts", func(t *testing.T) {
+		calls := 0
+		err := retryCheck(failing(&calls), true, RetryPolicy{Interval: time.Millisecond, Attempts: 3}, nil)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+		if calls != 3 {
+			t.Errorf("expected 3 attempts, got %d", calls)
+		}
+		if !strings.Contains(err.Error(), "3 attempts") || !strings.Contains(err.Error(), "not ready") {
+			t.Errorf("unexpected error message: %v", err)
+		}
+	})
+
+	t.Run("Persistent checks stop at the timeout", func(t *testing.T) {
+		calls := 0
+		start := time.Now()
+		err := retryCheck(failing(&calls), true, RetryPolicy{Timeout: 50 * time.Millisecond, Interval: 20 * time.Millisecond, Backoff: 2}, nil)
+		if err == nil {
+			t.Fatalf("expected error, got none")
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("expected retries to stop near the timeout, took %s", elapsed)
+		}
+		if calls < 2 {
+			t.Errorf("expected at least 2 attempts, got %d", calls)
+		}
+	})
+
+	t.Run("Persistent checks do not retry faster than the minimum interval", func(t *testing.T) {
+		calls := 0
+		retryCheck(failing(&calls), true, RetryPolicy{Timeout: 250 * time.Millisecond}, nil)
+		if calls > 4 {
+			t.Errorf("expected at most 4 attempts with a zero interval, got %d", calls)
+		}
+	})
+
+	t.Run("Persistent checks pass once the condition holds", func(t *testing.T) {
+		calls := 0
+		err := retryCheck(func() error {
+			calls++
+			if calls < 3 {
+				return errors.New("not ready")
+			}
+			return nil
+		}, true, RetryPolicy{Interval: time.Millisecond, Attempts: 5}, nil)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+	})
+
+	t.Run("Persistent checks stop when canceled", func(t *testing.T) {
+		calls := 0
+		done := make(chan struct{})
+		time.AfterFunc(20*time.Millisecond, func() { close(done) })
+		err := retryCheck(failing(&calls), true, RetryPolicy{Interval: 5 * time.Millisecond}, done)
+		if !errors.Is(err, errCanceled) {
+			t.Fatalf("expected the check to be canceled, got %v", err)
+		}
+	})
+	t.Run("Persistent groups stop on expansion errors", func(t *testing.T) {
+		scope := &Scope{Env: []string{}, Retry: &RetryPolicy{Interval: time.Millisecond, Attempts: 100}}
+		group := map[interface{}]interface{}{"@any": []interface{}{"ENV:${RETRY_MISSING:?required}"}}
+		start := time.Now()
+		err := EvaluateRules(scope, []interface{}{group})
+		var expandErr *process.ExpandError
+		if !errors.As(err, &expandErr) {
+			t.Fatalf("expected an expansion error, got %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("expected no retries, took %v", elapsed)
+		}
+	})
+}
+
+func TestRetryPolicyOptions(t *testing.T) {
+	policy, err := RetryPolicy{Timeout: time.Minute, Interval: time.Second}.withOptions(map[string]string{"timeout": "120s", "attempts": "4", "backoff": "1.5"})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	expected := RetryPolicy{Timeout: 120 * time.Second, Interval: time.Second, Attempts: 4, Backoff: 1.5}
+	if policy != expected {
+		t.Errorf("expected %+v, got %+v", expected, policy)
+	}
+
+	if _, err := (RetryPolicy{}).withOptions(map[string]string{"interval": "soon"}); err == nil {
+		t.Errorf("expected error for an invalid interval, got none")
+	}
+}
+
+func TestScopeRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{Interval: time.Millisecond, Attempts: 2}
+	scope := &Scope{Env: []string{}, Retry: &policy}
+
+	start := time.Now()
+	err := Evaluate(scope, []string{"@ENV:SCOPE_RETRY_MISSING"})
+	if err == nil {
+		t.Fatalf("expected the condition to fail, got none")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the scope policy to stop after 2 attempts, took %v", elapsed)
+	}
+	if DefaultRetryPolicy() == policy {
+		t.Errorf("expected the default retry policy to stay unchanged")
+	}
+}
@@ -0,0 +1,248 @@
+package check
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// loadPeriods are the load averages LOAD[period=...] can compare, in the order of /proc/loadavg.
+var loadPeriods = []string{"1m", "5m", "15m"}
+
+// systemCondition compares a measured quantity of the host with a limit.
+type systemCondition struct {
+	// what names the quantity in messages, i.e. "available memory".
+	what    string
+	op      string
+	limit   float64
+	display string
+	measure func(scope *Scope) (float64, error)
+	format  func(float64) string
+}
+
+func (c systemCondition) Evaluate(scope *Scope, negate bool) error {
+	value, err := c.measure(scope)
+	if err != nil {
+		return err
+	}
+	holds := compareNumbers(value, c.op, c.limit)
+	if negate && holds {
+		return fmt.Errorf("unexpected %s of %s is %s %s", c.what, c.format(value), c.op, c.display)
+	}
+	if !negate && !holds {
+		return fmt.Errorf("%s is %s, expected %s %s", c.what, c.format(value), c.op, c.display)
+	}
+	return nil
+}
+
+// splitLimit splits `path>=20GB` or `>=8GB` into the subject, operator and limit.
+func splitLimit(name, arg, example string) (string, string, string, error) {
+	subject, op, limit, ok := splitComparison(arg)
+	if !ok || limit == "" {
+		return "", "", "", fmt.Errorf("invalid %s check '%s', expected a comparison such as %s", name, arg, example)
+	}
+	return subject, op, limit, nil
+}
+
+// parseDisk builds the DISK: condition, which compares the space available to
+// unprivileged users on the filesystem of the path, in bytes or as a percentage.
+func parseDisk(arg string, options map[string]string) (Condition, error) {
+	path, op, limit, err := splitLimit("DISK", arg, "DISK:/var/lib/docker>=20GB")
+	if err != nil {
+		return nil, err
+	}
+	if path == "" {
+		path = "."
+	}
+
+	if percent, ok := strings.CutSuffix(limit, "%"); ok {
+		n, err := parseNumber(percent)
+		if err != nil {
+			return nil, err
+		}
+		return systemCondition{
+			what:    fmt.Sprintf("free space on '%s'", path),
+			op:      op,
+			limit:   n,
+			display: limit,
+			format:  func(v float64) string { return fmt.Sprintf("%.1f%%", v) },
+			measure: func(scope *Scope) (float64, error) {
+				avail, total, err := diskSpace(scope, path)
+				if err != nil || total == 0 {
+					return 0, err
+				}
+				return float64(avail) / float64(total) * 100, nil
+			},
+		}, nil
+	}
+
+	size, err := runnerexec.ParseSize(limit)
+	if err != nil {
+		return nil, err
+	}
+	return systemCondition{
+		what:    fmt.Sprintf("free space on '%s'", path),
+		op:      op,
+		limit:   float64(size),
+		display: limit,
+		format:  formatBytes,
+		measure: func(scope *Scope) (float64, error) {
+			avail, _, err := diskSpace(scope, path)
+			return float64(avail), err
+		},
+	}, nil
+}
+
+// parseMem builds the MEM condition, which compares the memory available
+// for new processes without swapping.
+func parseMem(arg string, options map[string]string) (Condition, error) {
+	subject, op, limit, err := splitLimit("MEM", arg, "MEM>=8GB")
+	if err != nil {
+		return nil, err
+	}
+	if subject != "" {
+		return nil, fmt.Errorf("invalid MEM check '%s', expected a comparison such as MEM>=8GB", arg)
+	}
+	size, err := runnerexec.ParseSize(limit)
+	if err != nil {
+		return nil, err
+	}
+	return systemCondition{
+		what:    "available memory",
+		op:      op,
+		limit:   float64(size),
+		display: limit,
+		format:  formatBytes,
+		measure: func(scope *Scope) (float64, error) {
+			avail, err := availableMemory(scope)
+			return float64(avail), err
+		},
+	}, nil
+}
+
+// parseLoad builds the LOAD condition, which compares the 1 minute load
+// average, or the one selected with the period option.
+func parseLoad(arg string, options map[string]string) (Condition, error) {
+	subject, op, limit, err := splitLimit("LOAD", arg, "LOAD<4")
+	if err != nil {
+		return nil, err
+	}
+	if subject != "" {
+		return nil, fmt.Errorf("invalid LOAD check '%s', expected a comparison such as LOAD<4", arg)
+	}
+	n, err := parseNumber(limit)
+	if err != nil {
+		return nil, err
+	}
+
+	period := 0
+	if value, ok := options["period"]; ok {
+		period = -1
+		for i, p := range loadPeriods {
+			if value == p {
+				period = i
+			}
+		}
+		if period == -1 {
+			return nil, fmt.Errorf("invalid period '%s', expected one of %s", value, strings.Join(loadPeriods, ", "))
+		}
+	}
+
+	return systemCondition{
+		what:    loadPeriods[period] + " load average",
+		op:      op,
+		limit:   n,
+		display: limit,
+		format:  func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) },
+		measure: func(scope *Scope) (float64, error) {
+			loads, err := loadAverages(scope)
+			if err != nil {
+				return 0, err
+			}
+			return loads[period], nil
+		},
+	}, nil
+}
+
+// formatBytes formats a size with decimal units, like the limits are usually written.
+func formatBytes(v float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB", "PB"}
+	i := 0
+	for v >= 1000 && i < len(units)-1 {
+		v /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%.0fB", v)
+	}
+	return fmt.Sprintf("%.1f%s", v, units[i])
+}
+
+// diskSpace returns the available and total bytes of the filesystem of the
+// path, on the remote host of the scope if any.
+func diskSpace(scope *Scope, path string) (uint64, uint64, error) {
+	if scope.Remote == nil {
+		return localDiskSpace(path)
+	}
+	ok, out, err := scope.runRemote("df -Pk " + runnerexec.ShellQuote(path))
+	if err != nil {
+		return 0, 0, err
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if !ok || len(lines) < 2 || len(fields) < 4 {
+		return 0, 0, fmt.Errorf("failed to get the free space on '%s' on the remote host: %s", path, strings.TrimSpace(out))
+	}
+	total, _ := strconv.ParseUint(fields[1], 10, 64)
+	avail, _ := strconv.ParseUint(fields[3], 10, 64)
+	return avail * 1024, total * 1024, nil
+}
+
+// availableMemory returns MemAvailable from /proc/meminfo, on the remote host of the scope if any.
+func availableMemory(scope *Scope) (uint64, error) {
+	content, err := readProcFile(scope, "/proc/meminfo")
+	if err != nil {
+		return 0, err
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if value, ok := strings.CutPrefix(line, "MemAvailable:"); ok {
+			kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimSpace(value), " kB"), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid MemAvailable '%s'", strings.TrimSpace(value))
+			}
+			return kb * 1024, nil
+		}
+	}
+	return 0, fmt.Errorf("MemAvailable not found in /proc/meminfo")
+}
+
+// loadAverages returns the 1, 5 and 15 minute load averages from /proc/loadavg,
+// on the remote host of the scope if any.
+func loadAverages(scope *Scope) ([3]float64, error) {
+	var loads [3]float64
+	content, err := readProcFile(scope, "/proc/loadavg")
+	if err != nil {
+		return loads, err
+	}
+	fields := strings.Fields(content)
+	if len(fields) < 3 {
+		return loads, fmt.Errorf("invalid /proc/loadavg '%s'", strings.TrimSpace(content))
+	}
+	for i := range loads {
+		if loads[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return loads, fmt.Errorf("invalid /proc/loadavg '%s'", strings.TrimSpace(content))
+		}
+	}
+	return loads, nil
+}
+
+// readProcFile reads a file of /proc, which only exists on Linux.
+func readProcFile(scope *Scope, path string) (string, error) {
+	if scope.Remote == nil && !procSupported {
+		return "", fmt.Errorf("%s is only available on Linux", path)
+	}
+	content, err := readFile(scope, path)
+	return string(content), err
+}
@@ -0,0 +1,15 @@
+package check
+
+import "golang.org/x/sys/unix"
+
+// procSupported reports whether /proc describes the memory and load of the host.
+const procSupported = true
+
+// localDiskSpace returns the available and total bytes of the filesystem of the path.
+func localDiskSpace(path string) (uint64, uint64, error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(path, &st); err != nil {
+		return 0, 0, err
+	}
+	return st.Bavail * uint64(st.Bsize), st.Blocks * uint64(st.Bsize), nil
+}
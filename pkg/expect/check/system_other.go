@@ -0,0 +1,16 @@
+//go:build !linux
+
+package check
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// procSupported reports whether /proc describes the memory and load of the host.
+const procSupported = false
+
+// localDiskSpace is only supported on Linux.
+func localDiskSpace(path string) (uint64, uint64, error) {
+	return 0, 0, fmt.Errorf("DISK checks are not supported on %s", runtime.GOOS)
+}
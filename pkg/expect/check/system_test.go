@@ -0,0 +1,67 @@
+//go:build linux
+
+package check
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSystemExpectations(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"DISK:" + dir + ">=1B", false},
+		{"DISK:" + dir + ">=1000TB", true},
+		{"!DISK:" + dir + ">=1000TB", false},
+		{"DISK:" + dir + ">0%", false},
+		{"DISK:" + dir + ">100%", true},
+		{"DISK>=1KB", false},
+		{"DISK:/no/such/path>=1B", true},
+		{"MEM>=1MB", false},
+		{"MEM:>=1MB", false},
+		{"MEM>=1000TB", true},
+		{"@MEM[timeout=1s]>=1MB", false},
+		{"LOAD<100000", false},
+		{"LOAD>100000", true},
+		{"LOAD[period=15m]<100000", false},
+		{"LOAD[period=2m]<4", true},
+		{"DISK:" + dir, true},
+		{"MEM>=lots", true},
+		{"LOAD<four", true},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(&Scope{}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	for expectation, expected := range map[string]string{
+		"MEM:":          "invalid MEM check '', expected a comparison such as MEM>=8GB",
+		"MEM:8GB":       "invalid MEM check '8GB', expected a comparison such as MEM>=8GB",
+		"MEM:/tmp>=1GB": "invalid MEM check '/tmp>=1GB', expected a comparison such as MEM>=8GB",
+		"MEM>=lots":     "invalid size 'lots'",
+	} {
+		if _, _, err := parseExpectation(&Scope{}, expectation); err == nil || err.Error() != expected {
+			t.Errorf("%s: expected the parse error %q, got %v", expectation, expected, err)
+		}
+	}
+
+	err := Evaluate(&Scope{}, []string{"DISK:" + dir + ">=1000TB"})
+	if err == nil || !strings.HasPrefix(err.Error(), "free space on '"+dir+"' is ") || !strings.HasSuffix(err.Error(), ", expected >= 1000TB") {
+		t.Errorf("expected the free and required space in the error, got %v", err)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for value, expected := range map[float64]string{512: "512B", 1500: "1.5KB", 20e9: "20.0GB", 3.5e12: "3.5TB"} {
+		if got := formatBytes(value); got != expected {
+			t.Errorf("expected %s for %v, got %s", expected, value, got)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package check
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// versionOperators are tried in order, so two character operators win over their prefixes.
+// `~1.14` allows patch updates of 1.14 and `^1.14` minor updates of 1.
+var versionOperators = []string{"==", "!=", ">=", "<=", ">", "<", "=", "~", "^"}
+
+// versionProbes are the commands that print the version of common tools.
+// Tools not listed are probed with `--version`.
+var versionProbes = map[string]string{
+	"go":        "go version",
+	"helm":      "helm version --short",
+	"kubectl":   "kubectl version --client",
+	"java":      "java -version",
+	"javac":     "javac -version",
+	"terraform": "terraform version",
+	"rustc":     "rustc --version",
+	"cargo":     "cargo --version",
+	"gcc":       "gcc -dumpfullversion",
+	"ssh":       "ssh -V",
+}
+
+// versionPattern finds the first version number in the output of a probe.
+var versionPattern = regexp.MustCompile(`\d+(\.\d+){0,3}`)
+
+// versionConstraint is a single `op version` part of a CMD: constraint.
+type versionConstraint struct {
+	op      string
+	version []int
+}
+
+// versionConstraints are all the constraints of a CMD: check, which must all hold.
+type versionConstraints []versionConstraint
+
+// parseVersionConstraints splits `go>=1.22` or `kubectl>=1.28,<1.31` into
+// the command and its constraints. Without an operator, the constraints are nil.
+func parseVersionConstraints(s string) (string, versionConstraints, error) {
+	start := strings.IndexAny(s, "=!<>~^")
+	if start == -1 {
+		return s, nil, nil
+	}
+	cmd := strings.TrimSpace(s[:start])
+	if cmd == "" {
+		return "", nil, fmt.Errorf("missing command in '%s'", s)
+	}
+
+	var constraints versionConstraints
+	for _, part := range strings.Split(s[start:], ",") {
+		part = strings.TrimSpace(part)
+		var op string
+		for _, candidate := range versionOperators {
+			if strings.HasPrefix(part, candidate) {
+				op = candidate
+				break
+			}
+		}
+		if op == "" {
+			return "", nil, fmt.Errorf("invalid version constraint '%s'", part)
+		}
+		version, err := parseVersion(strings.TrimPrefix(strings.TrimSpace(part[len(op):]), "v"))
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid version constraint '%s': %v", part, err)
+		}
+		constraints = append(constraints, versionConstraint{op: op, version: version})
+	}
+	return cmd, constraints, nil
+}
+
+// parseVersion parses a dotted version number such as 1.22 or 3.14.2.
+func parseVersion(s string) ([]int, error) {
+	if s == "" {
+		return nil, fmt.Errorf("missing version")
+	}
+	var version []int
+	for _, part := range strings.Split(s, ".") {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("'%s' is not a version number", s)
+		}
+		version = append(version, n)
+	}
+	return version, nil
+}
+
+// compareVersions compares two versions, treating missing parts as zero.
+func compareVersions(a, b []int) int {
+	for i := 0; i < max(len(a), len(b)); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// satisfiedBy reports whether the version satisfies the constraint.
+func (c versionConstraint) satisfiedBy(version []int) bool {
+	switch c.op {
+	case "=":
+		return compareVersions(version, c.version) == 0
+	case "~", "^":
+		if compareVersions(version, c.version) < 0 {
+			return false
+		}
+		// ~ keeps the major and minor version fixed, ^ only the major version
+		fixed := 1
+		if c.op == "~" {
+			fixed = min(len(c.version), 2)
+		}
+		for i := 0; i < fixed; i++ {
+			if i >= len(version) || version[i] != c.version[i] {
+				return false
+			}
+		}
+		return true
+	}
+	return compareOrdered(compareVersions(version, c.version), c.op)
+}
+
+// satisfiedBy reports whether the version satisfies all the constraints.
+func (cs versionConstraints) satisfiedBy(version []int) bool {
+	for _, c := range cs {
+		if !c.satisfiedBy(version) {
+			return false
+		}
+	}
+	return true
+}
+
+func (c versionConstraint) String() string {
+	return c.op + formatVersion(c.version)
+}
+
+func (cs versionConstraints) String() string {
+	parts := make([]string, len(cs))
+	for i, c := range cs {
+		parts[i] = c.String()
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatVersion(version []int) string {
+	parts := make([]string, len(version))
+	for i, n := range version {
+		parts[i] = strconv.Itoa(n)
+	}
+	return strings.Join(parts, ".")
+}
+
+// probeVersion runs the version probe of the command through the executor
+// of the scope and returns the first version number in its output.
+func probeVersion(scope *Scope, cmd, probe string) ([]int, error) {
+	if probe == "" {
+		probe = versionProbes[cmd]
+	}
+	if probe == "" {
+		probe = runnerexec.ShellQuote(cmd) + " --version"
+	}
+
+	result := <-runnerexec.Execute(scope.executor(), runnerexec.Command{
+		Exec:    "(" + probe + ") 2>&1",
+		Env:     scope.commandEnv(),
+		Dir:     scope.Dir,
+		Timeout: scope.Timeout,
+	}, nil)
+	if errors.Is(result.Err, runnerexec.ErrDryRun) {
+		return nil, result.Err
+	}
+	if result.ExitCode != 0 || (result.Err != nil && result.Output == "") {
+		err := result.Err
+		if err == nil {
+			err = fmt.Errorf("exit status %d", result.ExitCode)
+		}
+		return nil, fmt.Errorf("version probe '%s' failed: %v, output: %s", probe, err, strings.TrimSpace(result.Output))
+	}
+
+	match := versionPattern.FindString(result.Output)
+	if match == "" {
+		return nil, fmt.Errorf("version probe '%s' printed no version: %s", probe, strings.TrimSpace(result.Output))
+	}
+	return parseVersion(match)
+}
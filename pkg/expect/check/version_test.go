@@ -0,0 +1,86 @@
+package check
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVersionConstraints(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		expected   bool
+	}{
+		{">=1.22", "1.22.5", true},
+		{">=1.22", "1.21.9", false},
+		{"<1.31", "1.30.2", true},
+		{"<1.31", "1.31", false},
+		{"==1.22", "1.22.0", true},
+		{"=1.22.1", "1.22.0", false},
+		{"!=2", "2.0.0", false},
+		{"~3.14", "3.14.2", true},
+		{"~3.14", "3.15.0", false},
+		{"~3.14.2", "3.14.1", false},
+		{"~3.14.2", "3.14.9", true},
+		{"~3", "3.9", true},
+		{"^1.4", "1.9.0", true},
+		{"^1.4", "2.0.0", false},
+		{"^1.4", "1.3.9", false},
+		{">=1.28,<1.31", "1.30.1", true},
+		{">=1.28,<1.31", "1.31.0", false},
+		{">=v1.2", "1.2", true},
+	}
+
+	for _, tt := range tests {
+		_, constraints, err := parseVersionConstraints("tool" + tt.constraint)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.constraint, err)
+			continue
+		}
+		version, err := parseVersion(tt.version)
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.version, err)
+			continue
+		}
+		if got := constraints.satisfiedBy(version); got != tt.expected {
+			t.Errorf("%s %s: expected %v, got %v", tt.version, tt.constraint, tt.expected, got)
+		}
+	}
+
+	for _, invalid := range []string{"tool>=", "tool>=1.x", "tool>=1,2", ">=1.2"} {
+		if _, _, err := parseVersionConstraints(invalid); err == nil {
+			t.Errorf("%s: expected an error", invalid)
+		}
+	}
+}
+
+func TestCommandVersionExpectations(t *testing.T) {
+	tests := []struct {
+		expectation string
+		expectError bool
+	}{
+		{"CMD[version_cmd='echo sh version go1.22.5']:sh>=1.22", false},
+		{"CMD[version_cmd='echo v3.14.2+g1234567']:sh~3.14", false},
+		{"CMD[version_cmd='echo 1.21.0']:sh>=1.22", true},
+		{"!CMD[version_cmd='echo 1.21.0']:sh>=1.22", false},
+		{"!CMD[version_cmd='echo 1.22.0']:sh>=1.22", true},
+		{"CMD[version_cmd='echo no version']:sh>=1", true},
+		{"CMD[version_cmd='exit 3']:sh>=1", true},
+		{"CMD:nonexistentcmd>=1.0", true},
+		{"!CMD:nonexistentcmd>=1.0", false},
+		{"CMD[version_cmd='echo 1.0']:sh", true},
+		{"CMD:sh>=one", true},
+	}
+
+	for _, tt := range tests {
+		err := Evaluate(&Scope{}, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.expectation, tt.expectError, err)
+		}
+	}
+
+	err := Evaluate(&Scope{}, []string{"CMD[version_cmd='echo 1.21.3']:sh>=1.22"})
+	if err == nil || !strings.Contains(err.Error(), "version 1.21.3 does not satisfy >=1.22") {
+		t.Errorf("expected found and required versions in the error, got %v", err)
+	}
+}
@@ -5,7 +5,26 @@ import (
 	"github.com/jjuliano/runner/pkg/expect/process"
 )
 
+// Scope is what expectations are evaluated against.
+type Scope = check.Scope
+
+// Normalization is how output is cleaned up before expectations match it.
+type Normalization = check.Normalization
+
+// Result is the outcome of a rule and, for groups, of the rules in it.
+type Result = check.Result
+
 var (
-	ProcessExpectations = process.ProcessExpectations
-	CheckExpectations   = check.CheckExpectations
+	ProcessExpectations   = process.ProcessExpectations
+	CheckExpectations     = check.CheckExpectations
+	Evaluate              = check.Evaluate
+	EvaluateRules         = check.EvaluateRules
+	EvaluateResult        = check.EvaluateResult
+	EvaluateResults       = check.EvaluateResults
+	DefaultRetryPolicy    = check.DefaultRetryPolicy
+	SetDefaultRetryPolicy = check.SetDefaultRetryPolicy
+	DefaultNormalization  = check.DefaultNormalization
+	HasCheckPrefix        = check.HasCheckPrefix
+	ValidateCheck         = check.ValidateCheck
+	ChecksOutput          = check.ChecksOutput
 )
@@ -1,29 +1,207 @@
 package process
 
 import (
+	"fmt"
 	"os"
 	"strconv"
 	"strings"
+	"sync"
 )
 
+var (
+	strictMu sync.RWMutex
+	strict   bool
+)
+
+// Strict reports whether expanding an unset variable is an error.
+func Strict() bool {
+	strictMu.RLock()
+	defer strictMu.RUnlock()
+	return strict
+}
+
+// SetStrict sets whether expanding an unset variable without a default is an
+// error instead of an empty string.
+func SetStrict(s bool) {
+	strictMu.Lock()
+	defer strictMu.Unlock()
+	strict = s
+}
+
+// ExpandError is returned when a placeholder fails to expand, because of a
+// `${NAME:?message}` or of an unset variable in strict mode.
+type ExpandError struct {
+	Message string
+}
+
+func (e *ExpandError) Error() string {
+	return e.Message
+}
+
 // ReplaceVars replaces placeholders with environment variable values.
 func ReplaceVars(expectation string) string {
-	// This pattern matches ${VAR_NAME} and replaces it with the environment variable value.
-	for {
-		start := strings.Index(expectation, "${")
-		if start == -1 {
-			break
-		}
-		end := strings.Index(expectation[start:], "}")
-		if end == -1 {
-			break
-		}
-		end += start
-		varName := expectation[start+2 : end]
-		varValue := os.Getenv(varName)
-		expectation = expectation[:start] + varValue + expectation[end+1:]
-	}
-	return expectation
+	return ExpandVars(expectation, os.LookupEnv)
+}
+
+// ExpandVars replaces placeholders with the values returned by lookup, see
+// Expand. Placeholders that fail to expand are replaced with an empty string.
+func ExpandVars(expectation string, lookup func(string) (string, bool)) string {
+	expanded, _ := Expand(expectation, lookup)
+	return expanded
+}
+
+// Expand replaces placeholders with the values returned by lookup:
+//
+//	${NAME}          the value, an error in strict mode when NAME is unset
+//	${NAME:-word}    word when NAME is unset or empty
+//	${NAME:+word}    word when NAME is set and not empty, an empty string otherwise
+//	${NAME:?message} an error with the message when NAME is unset or empty
+//	$${NAME}         ${NAME}, without expanding it
+//
+// Without the colon, `-`, `+` and `?` only test whether NAME is set. Words
+// may contain placeholders, which are only expanded when the word is used.
+func Expand(s string, lookup func(string) (string, bool)) (string, error) {
+	e := &expander{lookup: lookup, strict: Strict()}
+	return e.expand(s), e.err
+}
+
+// ExpandCommand expands the placeholders of a shell command like Expand, but
+// leaves those of variables unknown to lookup, such as shell or loop
+// variables, for the shell to expand. Only a `${NAME:?message}` of an unknown
+// variable is an error, and only in strict mode.
+func ExpandCommand(s string, lookup func(string) (string, bool)) (string, error) {
+	e := &expander{lookup: lookup, strict: Strict(), command: true}
+	return e.expand(s), e.err
+}
+
+// expander expands the placeholders of a string and keeps the first error.
+type expander struct {
+	lookup  func(string) (string, bool)
+	strict  bool
+	command bool
+	err     error
+}
+
+func (e *expander) expand(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		escaped := strings.HasPrefix(s[i:], "$${")
+		if !escaped && !strings.HasPrefix(s[i:], "${") {
+			b.WriteByte(s[i])
+			i++
+			continue
+		}
+
+		open := i + 2
+		if escaped {
+			open++
+		}
+		end := closingBrace(s, open)
+		switch {
+		case end < 0:
+			// an unterminated placeholder is kept as is
+			b.WriteString(s[i:])
+			return b.String()
+		case escaped:
+			b.WriteString(s[i+1 : end+1])
+		default:
+			b.WriteString(e.substitute(s[i:end+1], s[open:end]))
+		}
+		i = end + 1
+	}
+	return b.String()
+}
+
+// closingBrace returns the index of the brace closing the placeholder whose
+// body starts at start, or -1.
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			if depth--; depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// substitute returns the value of a placeholder. Placeholders that do not
+// start with a variable name, or use an unknown operator, are kept as is.
+func (e *expander) substitute(placeholder, body string) string {
+	name := body[:nameLength(body)]
+	if name == "" {
+		return placeholder
+	}
+	value, set := e.lookup(name)
+
+	rest := body[len(name):]
+	if !set && e.command && !(e.strict && strings.HasPrefix(strings.TrimPrefix(rest, ":"), "?")) {
+		return placeholder
+	}
+	if rest == "" {
+		if !set && e.strict {
+			e.fail(fmt.Sprintf("variable '%s' is not set", name))
+		}
+		return value
+	}
+
+	checkEmpty := strings.HasPrefix(rest, ":")
+	if checkEmpty {
+		rest = rest[1:]
+	}
+	if rest == "" || !strings.ContainsRune("-+?", rune(rest[0])) {
+		return placeholder
+	}
+	op, word := rest[0], rest[1:]
+	unset := !set || (checkEmpty && value == "")
+
+	switch op {
+	case '-':
+		if unset {
+			return e.expand(word)
+		}
+	case '+':
+		if unset {
+			return ""
+		}
+		return e.expand(word)
+	case '?':
+		if unset {
+			message := e.expand(word)
+			if message == "" {
+				message = "is not set"
+				if set {
+					message = "is empty"
+				}
+				message = fmt.Sprintf("variable '%s' %s", name, message)
+			}
+			e.fail(message)
+			return ""
+		}
+	}
+	return value
+}
+
+func (e *expander) fail(message string) {
+	if e.err == nil {
+		e.err = &ExpandError{Message: message}
+	}
+}
+
+// nameLength returns the length of the variable name at the start of s.
+func nameLength(s string) int {
+	for i, r := range s {
+		isLetter := r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z')
+		if !isLetter && (i == 0 || r < '0' || r > '9') {
+			return i
+		}
+	}
+	return len(s)
 }
 
 // ProcessExpectations converts the expectations into a string slice.
@@ -31,3 +31,97 @@ func TestProcessExpectations(t *testing.T) {
 		}
 	}
 }
+
+func TestExpand(t *testing.T) {
+	env := map[string]string{"NAME": "web", "EMPTY": "", "PORT": "8080", "REF": "NAME"}
+	lookup := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	tests := []struct {
+		input       string
+		strict      bool
+		expected    string
+		expectError bool
+	}{
+		{"${NAME}:${PORT}", false, "web:8080", false},
+		{"${MISSING}", false, "", false},
+		{"${MISSING}", true, "", true},
+		{"${EMPTY}", true, "", false},
+		{"${MISSING:-default}", true, "default", false},
+		{"${EMPTY:-default}", false, "default", false},
+		{"${EMPTY-default}", false, "", false},
+		{"${NAME:-default}", false, "web", false},
+		{"${MISSING:-${NAME}-${PORT}}", false, "web-8080", false},
+		{"${MISSING:-${OTHER:-${PORT}}}", false, "8080", false},
+		{"${NAME:+set}", false, "set", false},
+		{"${EMPTY:+set}", false, "", false},
+		{"${EMPTY+set}", false, "set", false},
+		{"${MISSING:+${UNSET}}", true, "", false},
+		{"${NAME:?name is required}", false, "web", false},
+		{"${MISSING:?name is required}", false, "", true},
+		{"${EMPTY?required}", false, "", false},
+		{"$${NAME}", false, "${NAME}", false},
+		{"$${NAME:-${PORT}}", false, "${NAME:-${PORT}}", false},
+		{"cost: $5 ${PORT}", false, "cost: $5 8080", false},
+		{"${NAME", false, "${NAME", false},
+		{"${1abc} ${NAME:0:2}", true, "${1abc} ${NAME:0:2}", false},
+	}
+
+	for _, tt := range tests {
+		SetStrict(tt.strict)
+		result, err := Expand(tt.input, lookup)
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.input, tt.expectError, err)
+		}
+		if result != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, result)
+		}
+	}
+	SetStrict(false)
+
+	if _, err := Expand("${MISSING:?set MISSING to the cluster name}", lookup); err == nil || err.Error() != "set MISSING to the cluster name" {
+		t.Errorf("expected the message of the placeholder, got %v", err)
+	}
+	if _, err := Expand("${EMPTY:?}", lookup); err == nil || err.Error() != "variable 'EMPTY' is empty" {
+		t.Errorf("expected a default message, got %v", err)
+	}
+}
+
+func TestExpandCommand(t *testing.T) {
+	lookup := func(name string) (string, bool) {
+		if name == "STAGE" {
+			return "prod", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		input       string
+		strict      bool
+		expected    string
+		expectError bool
+	}{
+		{"deploy ${STAGE}", true, "deploy prod", false},
+		{"for f in *; do echo ${f}; done", true, "for f in *; do echo ${f}; done", false},
+		{"${REGION:-eu} ${REGION:+x} ${REGION-eu}", true, "${REGION:-eu} ${REGION:+x} ${REGION-eu}", false},
+		{"${REGION:-${STAGE}}", false, "${REGION:-${STAGE}}", false},
+		{"${STAGE:+${REGION}}", true, "${REGION}", false},
+		{"${REGION:?set REGION}", false, "${REGION:?set REGION}", false},
+		{"${REGION:?set REGION}", true, "", true},
+		{"$${STAGE}", false, "${STAGE}", false},
+	}
+
+	for _, tt := range tests {
+		SetStrict(tt.strict)
+		result, err := ExpandCommand(tt.input, lookup)
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s: expected error %v, got %v", tt.input, tt.expectError, err)
+		}
+		if result != tt.expected {
+			t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, result)
+		}
+	}
+	SetStrict(false)
+}
@@ -0,0 +1,106 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/expect"
+)
+
+// ErrChecksFailed is returned by commands that already reported which checks failed.
+var ErrChecksFailed = errors.New("checks failed")
+
+// checkReport is the JSON form of the result of a check.
+type checkReport struct {
+	Rule     string         `json:"rule"`
+	Passed   bool           `json:"passed"`
+	Skipped  bool           `json:"skipped,omitempty"`
+	Error    string         `json:"error,omitempty"`
+	Children []*checkReport `json:"children,omitempty"`
+}
+
+func newCheckReport(result *expect.Result) *checkReport {
+	report := &checkReport{Rule: result.Rule, Passed: result.Passed(), Skipped: result.Skipped}
+	if result.Err != nil && len(result.Children) == 0 {
+		report.Error = MaskSecrets(result.Err.Error())
+	}
+	for _, child := range result.Children {
+		report.Children = append(report.Children, newCheckReport(child))
+	}
+	return report
+}
+
+// HandleCheckCommand evaluates check expressions such as `CMD:helm` or
+// `@TCP:localhost:5432` outside of any workflow, in the working directory and
+// environment runner runs in. A positive timeout bounds each check and how
+// long persistent checks wait. It fails with ErrChecksFailed when a check fails.
+func (dr *DependencyResolver) HandleCheckCommand(rules []string, timeout time.Duration, jsonOutput bool) error {
+	if len(rules) == 0 {
+		return fmt.Errorf("no check given, i.e. runner check 'CMD:helm' '@TCP:localhost:5432'")
+	}
+	for _, rule := range rules {
+		if err := expect.ValidateCheck(rule); err != nil {
+			return err
+		}
+	}
+
+	scope := &expect.Scope{
+		Client:   &http.Client{Timeout: timeout},
+		Executor: dr.Executor,
+		Timeout:  timeout,
+	}
+	if timeout > 0 {
+		policy := expect.DefaultRetryPolicy()
+		policy.Timeout = timeout
+		scope.Retry = &policy
+	}
+
+	items := make([]interface{}, len(rules))
+	for i, rule := range rules {
+		items[i] = rule
+	}
+	results := expect.EvaluateResults(scope, items)
+
+	failed, skipped := 0, 0
+	for _, result := range results {
+		switch {
+		case result.Skipped:
+			skipped++
+		case !result.Passed():
+			failed++
+		}
+	}
+
+	if jsonOutput {
+		report := struct {
+			Passed bool           `json:"passed"`
+			Checks []*checkReport `json:"checks"`
+		}{Passed: failed == 0}
+		for _, result := range results {
+			report.Checks = append(report.Checks, newCheckReport(result))
+		}
+		data, err := json.MarshalIndent(report, "", "  ")
+		if err != nil {
+			return err
+		}
+		PrintMessage("%s\n", data)
+	} else {
+		for _, result := range results {
+			PrintMessage("%s\n", result)
+		}
+		if failed > 0 {
+			PrintMessage("%d of %d checks failed\n", failed, len(results))
+		}
+		if skipped > 0 {
+			PrintMessage("%d of %d checks skipped\n", skipped, len(results))
+		}
+	}
+
+	if failed > 0 {
+		return ErrChecksFailed
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package resolver
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jjuliano/runner/pkg/expect"
+)
+
+func TestHandleCheckCommand(t *testing.T) {
+	resolver, _ := setupEnvTestResolver(t)
+	t.Setenv("CHECK_STAGE", "staging")
+	policy := expect.DefaultRetryPolicy()
+
+	var err error
+	output := captureOutput(func() {
+		err = resolver.HandleCheckCommand([]string{"CMD:sh", "!ENV:CHECK_MISSING", "ENV:CHECK_STAGE=production"}, 0, false)
+	})
+	if !errors.Is(err, ErrChecksFailed) {
+		t.Errorf("Expected ErrChecksFailed, got %v", err)
+	}
+	for _, expected := range []string{
+		"[passed] CMD:sh",
+		"[passed] !ENV:CHECK_MISSING",
+		"[failed] ENV:CHECK_STAGE=production: environment variable 'CHECK_STAGE' is not 'production'",
+		"1 of 3 checks failed",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+
+	output = captureOutput(func() {
+		err = resolver.HandleCheckCommand([]string{"CMD:sh", "@ENV:CHECK_STAGE"}, time.Second, true)
+	})
+	if err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+	var report struct {
+		Passed bool
+		Checks []checkReport
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Expected JSON output, got %v:\n%s", err, output)
+	}
+	if !report.Passed || len(report.Checks) != 2 || report.Checks[1].Rule != "@ENV:CHECK_STAGE" {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+	if expect.DefaultRetryPolicy() != policy {
+		t.Errorf("Expected --timeout to leave the default retry policy alone, got %+v", expect.DefaultRetryPolicy())
+	}
+
+	for _, rules := range [][]string{nil, {"CMD:sh", "helm"}, {"FOO:bar"}, {"@!CMD:sh"}} {
+		if err := resolver.HandleCheckCommand(rules, 0, false); err == nil || errors.Is(err, ErrChecksFailed) {
+			t.Errorf("%v: expected a usage error, got %v", rules, err)
+		}
+	}
+}
@@ -1,14 +1,15 @@
 package resolver
 
 import (
-	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"net/http"
-	"os"
 	"strings"
 	"sync"
 
 	"github.com/jjuliano/runner/pkg/expect"
+	"github.com/jjuliano/runner/pkg/expect/process"
 	"github.com/jjuliano/runner/pkg/runnerexec"
 )
 
@@ -19,6 +20,7 @@ type StepLog struct {
 	id        string
 	command   string
 	targetRes string
+	host      string
 }
 
 // RunnerLogs manages the logging mechanism with synchronization.
@@ -35,10 +37,64 @@ func (m *RunnerLogs) Add(entry StepLog) {
 	if m.closed {
 		return
 	}
+	entry.message = MaskSecrets(entry.message)
+	entry.command = MaskSecrets(entry.command)
 	fmt.Println(FormatLogEntry(entry))
 	m.entries = append(m.entries, entry)
 }
 
+// Stream prints the header of entry and returns a writer that prints the
+// output of its command as it arrives, a line at a time and with secrets
+// masked. Finish adds entry once the command is done.
+func (m *RunnerLogs) Stream(entry StepLog) *StepStream {
+	header := entry
+	header.message = ""
+	m.print(FormatLogEntry(header))
+	return &StepStream{logs: m, entry: entry}
+}
+
+// print prints s with secrets masked, unless the log is closed.
+func (m *RunnerLogs) print(s string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.closed {
+		fmt.Print(MaskSecrets(s))
+	}
+}
+
+// StepStream is the output of a step that is being logged while it runs.
+type StepStream struct {
+	logs    *RunnerLogs
+	entry   StepLog
+	partial []byte
+}
+
+// Write prints the complete lines of b and keeps the rest for the next write.
+func (s *StepStream) Write(b []byte) (int, error) {
+	s.partial = append(s.partial, b...)
+	if i := bytes.LastIndexByte(s.partial, '\n'); i >= 0 {
+		s.logs.print(string(s.partial[:i+1]))
+		s.partial = append([]byte(nil), s.partial[i+1:]...)
+	}
+	return len(b), nil
+}
+
+// Finish prints what is left of the output and adds the entry with the whole
+// output of the command as its message.
+func (s *StepStream) Finish(message string) {
+	s.logs.print(string(s.partial) + "\n")
+	s.partial = nil
+
+	s.logs.mu.Lock()
+	defer s.logs.mu.Unlock()
+	if s.logs.closed {
+		return
+	}
+	s.entry.message = MaskSecrets(message)
+	s.entry.command = MaskSecrets(s.entry.command)
+	s.logs.entries = append(s.logs.entries, s.entry)
+}
+
 // Close closes the log after all goroutines are done.
 func (m *RunnerLogs) Close() {
 	m.mu.Lock()
@@ -73,82 +129,77 @@ func (m *RunnerLogs) GetAllMessageString() string {
 
 // FormatLogEntry formats a log entry into a string.
 func FormatLogEntry(entry StepLog) string {
-	return strings.Join([]string{
+	lines := []string{
 		"\n",
 		"📦 Id: " + entry.id,
 		"📛 Step: " + entry.name,
-		"📝 Command: " + entry.command,
-		"\n" + entry.message,
-	}, "\n")
-}
-
-func SourceEnvFile(envFilePath string) error {
-	LogDebug(fmt.Sprintf("Sourcing environment file from path: %s", envFilePath))
-
-	file, err := os.Open(envFilePath)
-	if err != nil {
-		return LogError(fmt.Sprintf("Failed to open environment file: %s - %v", envFilePath, err), err)
-	}
-	defer func(file *os.File) {
-		err := file.Close()
-		if err != nil {
-			LogError(fmt.Sprintf("Failed to close environment file: %s - %v", envFilePath, err), err)
-		} else {
-			LogDebug(fmt.Sprintf("Successfully closed environment file: %s", envFilePath))
-		}
-	}(file)
-
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
-		LogDebug(fmt.Sprintf("Processing line: %s", line))
-
-		parts := strings.SplitN(line, "=", 2)
-		if len(parts) != 2 {
-			return LogError(fmt.Sprintf("Invalid environment variable declaration: %s in file: %s", line, envFilePath), err)
-		}
-
-		key := parts[0]
-		value := strings.Trim(parts[1], "\"")
-		if err := os.Setenv(key, value); err != nil {
-			return LogError(fmt.Sprintf("Failed to set environment variable %s: %v - %s", key, err, envFilePath), err)
-		}
-		LogDebug(fmt.Sprintf("Set environment variable %s=%s", key, value))
 	}
-
-	if err := scanner.Err(); err != nil {
-		return LogError(fmt.Sprintf("Error reading environment file: %s - %v", envFilePath, err), err)
+	if entry.host != "" {
+		lines = append(lines, "🖥️  Host: "+entry.host)
 	}
-
-	LogDebug(fmt.Sprintf("Successfully sourced environment file: %s", envFilePath))
-	return nil
+	return strings.Join(append(lines,
+		"📝 Command: "+entry.command,
+		"\n"+entry.message,
+	), "\n")
 }
 
 // ProcessNodeSteps processes each step by executing the relevant checks.
 func (dr *DependencyResolver) ProcessNodeSteps(steps []interface{}, stepType, resNode string, client *http.Client, logs *RunnerLogs) error {
+	env, err := dr.composeEnv(resNode, RunStep{}, nil)
+	if err != nil {
+		return err
+	}
+	return dr.processNodeSteps(steps, stepType, resNode, dr.ruleScope(client, RunStep{}, env), logs)
+}
+
+func (dr *DependencyResolver) processNodeSteps(steps []interface{}, stepType, resNode string, scope *expect.Scope, logs *RunnerLogs) error {
 	for _, step := range steps {
 		LogInfo(fmt.Sprintf("Processing '%s' step: '%v' - '%s'", stepType, step, resNode))
-		if err := ProcessSingleNodeRule(step, client, logs); err != nil {
+		if err := processSingleNodeRule(step, scope, logs); errors.Is(err, runnerexec.ErrDryRun) {
+			return err
+		} else if err != nil {
 			return LogError(fmt.Sprintf("Error processing step '%v' in '%s' steps: ", step, stepType), err)
 		}
 	}
 	return nil
 }
 
+// ruleScope returns the scope the rules of a step are evaluated in, which is the bound remote host if any.
+func (dr *DependencyResolver) ruleScope(client *http.Client, step RunStep, env stepEnv) *expect.Scope {
+	return &expect.Scope{
+		Client:    client,
+		Env:       env.vars,
+		Executor:  dr.Executor,
+		Dir:       step.Dir,
+		Timeout:   step.Timeout,
+		Remote:    dr.remote(),
+		RemoteEnv: env.declared,
+		Export:    ExportEnv,
+		Normalize: step.Normalize.normalization(),
+	}
+}
+
 // ProcessSingleNodeRule processes an individual step element based on its type.
 func ProcessSingleNodeRule(element interface{}, client *http.Client, logs *RunnerLogs) error {
+	return processSingleNodeRule(element, &expect.Scope{Client: client}, logs)
+}
+
+func processSingleNodeRule(element interface{}, scope *expect.Scope, logs *RunnerLogs) error {
 	switch val := element.(type) {
 	case string:
 		if HasValidRulePrefix(val) {
-			return expect.CheckExpectations(logs.GetAllMessageString(), 0, []string{val}, client)
+			scope.Output = logs.GetAllMessageString()
+			return expect.Evaluate(scope, []string{val})
 		} else {
 			LogInfo(fmt.Sprintf("Skipping check condition '%s' unsupported.", val))
 		}
 	case map[interface{}]interface{}:
 		if expectVal, exists := val["expect"]; exists {
 			ev := expectVal.([]interface{})
-			return ProcessResourceNodeRules(ev, client, logs)
+			return processResourceNodeRules(ev, scope, logs)
 		}
+		scope.Output = logs.GetAllMessageString()
+		return expect.EvaluateRules(scope, []interface{}{val})
 	default:
 		LogErrorExit(fmt.Sprintf("Unsupported Step: %v", val), nil)
 	}
@@ -157,104 +208,87 @@ func ProcessSingleNodeRule(element interface{}, client *http.Client, logs *Runne
 
 // ProcessResourceNodeRules checks the expectations in the provided list.
 func ProcessResourceNodeRules(expectations []interface{}, client *http.Client, logs *RunnerLogs) error {
-	strs := make([]string, len(expectations))
-	for i, v := range expectations {
-		if s, ok := v.(string); ok {
-			strs[i] = s
-		}
-	}
-	return expect.CheckExpectations(logs.GetAllMessageString(), 0, strs, client)
+	return processResourceNodeRules(expectations, &expect.Scope{Client: client}, logs)
+}
+
+func processResourceNodeRules(expectations []interface{}, scope *expect.Scope, logs *RunnerLogs) error {
+	scope.Output = logs.GetAllMessageString()
+	return expect.EvaluateRules(scope, expectations)
 }
 
 // HasValidRulePrefix checks if the string has a valid prefix for checks.
 func HasValidRulePrefix(s string) bool {
-	prefixes := []string{"ENV:", "FILE:", "DIR:", "URL:", "CMD:", "EXEC:", "!", "@", "!@"}
+	prefixes := []string{"!", "@", "!@"}
 	for _, prefix := range prefixes {
 		if strings.HasPrefix(s, prefix) {
 			return true
 		}
 	}
+	if expect.HasCheckPrefix(s) {
+		return true
+	}
 	return strings.HasPrefix(s, "\"") && strings.HasSuffix(s, "\"")
 }
 
-func (dr *DependencyResolver) ProcessResourceNodeEnvVarDeclarations(envVars []EnvVar) error {
-	for _, envVar := range envVars {
-		var value string
-
-		if envVar.Exec != "" {
-			var result runnerexec.CommandResult
-			var ok bool
-
-			resultChan := dr.ShellSession.ExecuteCommand(envVar.Exec)
-			result, ok = <-resultChan
-
-			if !ok {
-				LogErrorExit(fmt.Sprintf("Failed to set ENV VAR: '%s'", envVar.Exec), nil)
-			}
-			value = result.Output
-		} else if envVar.Input != "" {
-			fmt.Print(envVar.Input + ": ")
-
-			_, err := fmt.Scanln(&value)
-			if err != nil {
-				LogErrorExit(fmt.Sprintf("Failed to read input for environment variable %s: ", envVar.Name), err)
-			}
-		} else if envVar.File != "" {
-			// Check if envVar.File starts with a "$" to resolve environment variable
-			if strings.HasPrefix(envVar.File, "$") {
-				envVarName := envVar.File[1:] // Remove the "$" prefix
-				filePath := os.Getenv(envVarName)
-				if filePath == "" {
-					LogErrorExit(fmt.Sprintf("Environment variable %s not set or empty", envVarName), nil)
-				}
-				envVar.File = filePath
-			}
-		} else {
-			value = envVar.Value
-		}
-
-		if err := os.Setenv(envVar.Name, value); err != nil {
-			LogErrorExit(fmt.Sprintf("Failed to set environment variable %s: ", envVar.Name), err)
-		}
+func (dr *DependencyResolver) ExecuteAndLogCommand(step RunStep, resName string, resNode string, logs *RunnerLogs) error {
+	// Resolve the environment of the step
+	env, err := dr.resolveStepEnv(resNode, step)
+	if err != nil {
+		LogErrorExit(fmt.Sprintf("Failed to set environment variables for step: '%s'", step.Name), err)
 	}
-	return nil
+	_, err = dr.executeAndLogCommand(step, resName, resNode, env, logs)
+	return err
 }
 
-func (dr *DependencyResolver) ExecuteAndLogCommand(step RunStep, resName string, resNode string, logs *RunnerLogs) error {
+func (dr *DependencyResolver) executeAndLogCommand(step RunStep, resName string, resNode string, env stepEnv, logs *RunnerLogs) (runnerexec.CommandResult, error) {
 	LogInfo(fmt.Sprintf("Executing command: '%s' for resource: '%s', step: '%s'", step.Exec, resName, step.Name))
 
-	// Set environment variables
-	if err := dr.ProcessResourceNodeEnvVarDeclarations(step.Env); err != nil {
-		LogErrorExit(fmt.Sprintf("Failed to set environment variables for step: '%s'", step.Name), err)
+	limits, err := step.Limits.ExecLimits()
+	if err != nil {
+		LogErrorExit(fmt.Sprintf("Invalid limits for step: '%s'", step.Name), err)
+	}
+
+	command, err := process.ExpandCommand(step.Exec, func(name string) (string, bool) {
+		return lookupEnv(env.vars, name)
+	})
+	if err != nil {
+		return runnerexec.CommandResult{}, fmt.Errorf("command of step '%s': %v", step.Name, err)
 	}
 
 	var result runnerexec.CommandResult
 	var ok bool
 
-	execResultChan := dr.ShellSession.ExecuteCommand(step.Exec)
-	result, ok = <-execResultChan
-	logEntry := StepLog{
+	stream := logs.Stream(StepLog{
 		targetRes: resNode,
 		command:   step.Exec,
 		id:        resName,
 		name:      step.Name,
-		message:   result.Output,
-	}
-	logs.Add(logEntry)
+		host:      dr.host,
+	})
+	execResultChan := runnerexec.Execute(dr.Executor, runnerexec.Command{Exec: command, Env: dr.commandEnv(env), Dir: step.Dir, Limits: limits, Timeout: step.Timeout}, stream)
+	result, ok = <-execResultChan
+	stream.Finish(result.Output)
 
 	if !ok {
 		LogErrorExit(fmt.Sprintf("Failed to execute command: '%s'", step.Exec), nil)
 	}
 
-	if result.Err != nil {
+	if result.Err != nil && !errors.Is(result.Err, runnerexec.ErrDryRun) {
 		LogErrorExit(fmt.Sprintf("Command execution error for '%s' ", step.Name), result.Err)
 	}
 
-	return nil
+	return result, nil
 }
 
 // HandleRunCommand handles the 'run' command for the given resources.
 func (dr *DependencyResolver) HandleRunCommand(resources []string) error {
+	if err := dr.prepareDotenv(); err != nil {
+		return err
+	}
+	if err := dr.ValidateRequiredEnv(resources); err != nil {
+		return err
+	}
+
 	logs := &RunnerLogs{}
 
 	visited := make(map[string]bool)
@@ -273,6 +307,7 @@ func (dr *DependencyResolver) HandleRunCommand(resources []string) error {
 
 	// Close the log after all processing is done.
 	logs.Close()
+	dr.closeRemotes()
 
 	return nil
 }
@@ -285,11 +320,38 @@ func (dr *DependencyResolver) ResolveResourceNodeDependency(resNode string, res
 		return
 	}
 
+	hosts, err := dr.ResourceHosts(res)
+	if err != nil {
+		LogErrorExit(fmt.Sprintf("Failed to resolve hosts for resource '%s'", resNode), err)
+	}
+	if len(hosts) == 0 {
+		dr.runResourceNodeSteps(resNode, res, logs, client)
+		return
+	}
+
+	for _, host := range hosts {
+		LogInfo(fmt.Sprintf("Running resource '%s' on host '%s'", resNode, host))
+		hostResolver, err := dr.onHost(host)
+		if err != nil {
+			LogErrorExit(fmt.Sprintf("Failed to connect to host '%s' for resource '%s'", host, resNode), err)
+		}
+		hostResolver.runResourceNodeSteps(resNode, res, logs, client)
+	}
+}
+
+// runResourceNodeSteps evaluates the skip rules of a resource and runs its steps.
+func (dr *DependencyResolver) runResourceNodeSteps(resNode string, res ResourceNodeEntry, logs *RunnerLogs, client *http.Client) {
+	if err := dr.prepareResourceEnv(res); err != nil {
+		LogErrorExit(fmt.Sprintf("Failed to set environment variables for resource: '%s'", resNode), err)
+	}
+
 	skipResults := make(map[StepKey]bool)
 	mu := &sync.Mutex{}
 
 	for _, step := range res.Run {
-		dr.ProcessNodeSkipRules(step, resNode, skipResults, mu, client, logs)
+		if err := dr.ProcessNodeSkipRules(step, resNode, skipResults, mu, client, logs); err != nil {
+			LogErrorExit(fmt.Sprintf("Failed to evaluate the skip rules of resource: '%s'", resNode), err)
+		}
 	}
 
 	skip := dr.BuildNodeSkipMap(res.Run, resNode, skipResults)
@@ -299,19 +361,33 @@ func (dr *DependencyResolver) ResolveResourceNodeDependency(resNode string, res
 	}
 }
 
-// ProcessNodeSkipRules processes skip steps for a given step.
-func (dr *DependencyResolver) ProcessNodeSkipRules(step RunStep, resNode string, skipResults map[StepKey]bool, mu *sync.Mutex, client *http.Client, logs *RunnerLogs) {
+// ProcessNodeSkipRules processes skip steps for a given step. A rule whose
+// placeholders fail to expand is an error rather than a condition that does
+// not hold.
+func (dr *DependencyResolver) ProcessNodeSkipRules(step RunStep, resNode string, skipResults map[StepKey]bool, mu *sync.Mutex, client *http.Client, logs *RunnerLogs) error {
 	if skipSteps, ok := step.Skip.([]interface{}); ok {
+		env, err := dr.composeEnv(resNode, step, nil)
+		if err != nil {
+			LogErrorExit(fmt.Sprintf("Failed to set environment variables for step: '%s'", step.Name), err)
+		}
+
 		for _, skipStep := range skipSteps {
-			if skipStr, ok := skipStep.(string); ok && HasValidRulePrefix(skipStr) {
-				if err := ProcessSingleNodeRule(skipStr, client, logs); err == nil {
+			skipStr, isString := skipStep.(string)
+			_, isMap := skipStep.(map[interface{}]interface{})
+			if (isString && HasValidRulePrefix(skipStr)) || isMap {
+				err := processSingleNodeRule(skipStep, dr.ruleScope(client, step, env), logs)
+				var expandErr *process.ExpandError
+				if errors.As(err, &expandErr) {
+					return fmt.Errorf("skip rule of step '%s': %w", step.Name, err)
+				}
+				if err == nil {
 					mu.Lock()
 					skipResults[StepKey{name: step.Name, node: resNode}] = true
 					mu.Unlock()
 
 					LogDebug(fmt.Sprintf("Skipping step '%s' for node '%s' due to skip condition", step.Name, resNode))
 
-					return
+					return nil
 				}
 			}
 		}
@@ -321,6 +397,7 @@ func (dr *DependencyResolver) ProcessNodeSkipRules(step RunStep, resNode string,
 
 		LogDebug(fmt.Sprintf("Not skipping step '%s' for node '%s'", step.Name, resNode))
 	}
+	return nil
 }
 
 // BuildNodeSkipMap builds a map of skip results.
@@ -338,35 +415,63 @@ func (dr *DependencyResolver) HandleResourceNodeStep(step RunStep, resNode strin
 	LogDebug(fmt.Sprintf("Skip key '%v' = %v", skipKey, skip[skipKey]))
 
 	if skip[skipKey] {
-		logs.Add(StepLog{targetRes: resNode, command: step.Exec, id: resNode, name: step.Name, message: "Step skipped."})
+		logs.Add(StepLog{targetRes: resNode, command: step.Exec, id: resNode, name: step.Name, message: "Step skipped.", host: dr.host})
 		LogInfo("Step: '" + step.Name + "' skipped for resource: '" + resNode + "'")
 		return
 	}
 
+	env, err := dr.resolveStepEnv(resNode, step)
+	if err != nil {
+		LogErrorExit(fmt.Sprintf("Failed to set environment variables for step: '%s'", step.Name), err)
+	}
+
+	var result runnerexec.CommandResult
 	if step.Exec != "" {
-		if err := dr.ExecuteAndLogCommand(step, resNode, resNode, logs); err != nil {
+		if result, err = dr.executeAndLogCommand(step, resNode, resNode, env, logs); err != nil {
 			LogErrorExit(fmt.Sprintf("Execution failed for step '%s' of resource '%s': ", step.Name, resNode), err)
 		}
+
+		// Pick up variables the command exported through $RUNNER_ENV
+		if env, err = dr.refreshStepEnv(resNode, step, env); err != nil {
+			LogErrorExit(fmt.Sprintf("Failed to source environment file for step: '%s'", step.Name), err)
+		}
+	}
+
+	if errors.Is(result.Err, runnerexec.ErrDryRun) {
+		if step.Check != nil || step.Expect != nil {
+			LogInfo(fmt.Sprintf("Skipping checks and expectations of step '%s' in dry run", step.Name))
+		}
+		return
 	}
 
 	if checkSteps, ok := step.Check.([]interface{}); ok {
-		if err := dr.ProcessNodeSteps(checkSteps, "check", resNode, client, logs); err != nil {
+		scope := dr.ruleScope(client, step, env)
+		scope.StepOutput, scope.HasStepOutput, scope.ExitCode = result.Output, step.Exec != "", result.ExitCode
+		if err := dr.processNodeSteps(checkSteps, "check", resNode, scope, logs); err != nil && !skippedInDryRun(step, err) {
 			LogErrorExit("Check expectation failed for resource '"+resNode+"' step '"+step.Name+"'", err)
 		}
 	}
 
 	if expectSteps, ok := step.Expect.([]interface{}); ok {
-		if err := SourceEnvFile(os.Getenv("RUNNER_ENV")); err != nil {
-			LogErrorExit(fmt.Sprintf("Failed to source environment file for step: '%s'", step.Name), err)
-		}
-
-		expectations := expect.ProcessExpectations(expectSteps)
-		if err := expect.CheckExpectations(logs.GetAllMessageString(), 0, expectations, client); err != nil {
+		scope := dr.ruleScope(client, step, env)
+		scope.Output = logs.GetAllMessageString()
+		scope.StepOutput, scope.HasStepOutput, scope.ExitCode = result.Output, step.Exec != "", result.ExitCode
+		if err := expect.EvaluateRules(scope, expectSteps); err != nil && !skippedInDryRun(step, err) {
 			LogErrorExit(fmt.Sprintf("Expectation failed for '%s': ", step.Name), err)
 		}
 	}
 }
 
+// skippedInDryRun reports whether err comes from a command that was not run
+// in a dry run, which leaves the outcome of the rules of step unknown.
+func skippedInDryRun(step RunStep, err error) bool {
+	if !errors.Is(err, runnerexec.ErrDryRun) {
+		return false
+	}
+	LogInfo(fmt.Sprintf("Skipping rules of step '%s' that depend on commands in dry run: %v", step.Name, err))
+	return true
+}
+
 // HandleShowCommand handles the 'show' command for the given resources.
 func (dr *DependencyResolver) HandleShowCommand(resources []string) error {
 	for _, res := range resources {
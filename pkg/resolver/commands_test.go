@@ -2,11 +2,16 @@ package resolver
 
 import (
 	"net/http"
+	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/jjuliano/runner/pkg/expect"
+	"github.com/jjuliano/runner/pkg/expect/process"
 	"github.com/jjuliano/runner/pkg/runnerexec"
 	"github.com/spf13/afero"
 	"gopkg.in/yaml.v2"
@@ -199,6 +204,22 @@ func TestProcessSkipSteps(t *testing.T) {
 			},
 			expectedSkip: false,
 		},
+		{
+			name: "Skip group",
+			step: RunStep{
+				Name: "test_step4",
+				Skip: []interface{}{map[interface{}]interface{}{"any": []interface{}{"CMD:invalidCommand", "ENV:HOME"}}},
+			},
+			expectedSkip: true,
+		},
+		{
+			name: "Failing skip group",
+			step: RunStep{
+				Name: "test_step5",
+				Skip: []interface{}{map[interface{}]interface{}{"all": []interface{}{"CMD:invalidCommand", "ENV:HOME"}}},
+			},
+			expectedSkip: false,
+		},
 		{
 			name: "No skip steps",
 			step: RunStep{
@@ -212,7 +233,9 @@ func TestProcessSkipSteps(t *testing.T) {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			// Process skip steps
-			resolver.ProcessNodeSkipRules(tc.step, "test_node", skipResults, mu, client, &RunnerLogs{})
+			if err := resolver.ProcessNodeSkipRules(tc.step, "test_node", skipResults, mu, client, &RunnerLogs{}); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
 
 			// Check the result
 			skipKey := StepKey{name: tc.step.Name, node: "test_node"}
@@ -227,6 +250,40 @@ func TestProcessSkipSteps(t *testing.T) {
 	}
 }
 
+func TestSkipRuleExpansionErrors(t *testing.T) {
+	client := &http.Client{}
+	resolver := setupTestRunResolver()
+	skipResults := make(map[StepKey]bool)
+	mu := &sync.Mutex{}
+
+	tests := []struct {
+		skip   []interface{}
+		strict bool
+	}{
+		{[]interface{}{"ENV:${SKIP_MISSING:?SKIP_MISSING is required}"}, false},
+		{[]interface{}{"ENV:${SKIP_MISSING}"}, true},
+		{[]interface{}{map[interface{}]interface{}{"any": []interface{}{"ENV:${SKIP_MISSING:?required}", "ENV:HOME"}}}, false},
+	}
+	for _, tt := range tests {
+		process.SetStrict(tt.strict)
+		step := RunStep{Name: "expand_step", Skip: tt.skip}
+		if err := resolver.ProcessNodeSkipRules(step, "test_node", skipResults, mu, client, &RunnerLogs{}); err == nil {
+			t.Errorf("%v: expected an expansion error, got none", tt.skip)
+		}
+	}
+	process.SetStrict(false)
+
+	// A rule that depends on a command not run in a dry run does not skip the step
+	resolver.Executor = runnerexec.DryRunExecutor{}
+	step := RunStep{Name: "dry_run_step", Skip: []interface{}{"EXEC:true"}}
+	if err := resolver.ProcessNodeSkipRules(step, "test_node", skipResults, mu, client, &RunnerLogs{}); err != nil {
+		t.Errorf("Expected no error in dry run, got %v", err)
+	}
+	if skipResults[StepKey{name: step.Name, node: "test_node"}] {
+		t.Errorf("Expected the step not to be skipped in dry run")
+	}
+}
+
 func TestAddLogEntry(t *testing.T) {
 	setupTestRunResolver()
 	logs := RunnerLogs{}
@@ -262,3 +319,227 @@ func TestAddLogEntry(t *testing.T) {
 	}
 
 }
+
+func TestHandleRunCommandWithRecordingExecutor(t *testing.T) {
+	recorder := runnerexec.NewRecordingExecutor(nil)
+	resolver, err := NewGraphResolver(afero.NewMemMapFs(), log.New(nil), "", recorder)
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+
+	dir := t.TempDir()
+	prepare, build := "touch "+filepath.Join(dir, "base"), "touch "+filepath.Join(dir, "app")
+	resolver.Resources = []ResourceNodeEntry{
+		{Id: "base", Run: []RunStep{{Name: "prepare", Exec: prepare}}},
+		{Id: "app", Requires: []string{"base"}, Run: []RunStep{{Name: "build", Exec: build}}},
+	}
+	for _, entry := range resolver.Resources {
+		resolver.ResourceDependencies[entry.Id] = entry.Requires
+	}
+
+	captureOutput(func() {
+		if err := resolver.HandleRunCommand([]string{"app"}); err != nil {
+			t.Fatalf("Error running resources: %v", err)
+		}
+	})
+
+	commands := recorder.Commands()
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 recorded commands, got %d", len(commands))
+	}
+	if commands[0].Exec != prepare || commands[1].Exec != build {
+		t.Errorf("Unexpected recorded commands: %+v", commands)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app")); err == nil {
+		t.Errorf("Expected recorded command not to be executed")
+	}
+}
+
+func TestHandleRunCommandInDryRun(t *testing.T) {
+	resolver, err := NewGraphResolver(afero.NewMemMapFs(), log.New(nil), "", runnerexec.DryRunExecutor{})
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+
+	resolver.Resources = []ResourceNodeEntry{{
+		Id:  "app",
+		Env: []EnvVar{{Name: "VERSION", Exec: "git describe"}},
+		Run: []RunStep{
+			{Name: "build", Exec: "make build", Expect: []interface{}{"TEXT:built"}},
+			{Name: "verify", Check: []interface{}{"EXEC:make test"}},
+		},
+	}}
+	resolver.ResourceDependencies["app"] = nil
+
+	output := captureOutput(func() {
+		if err := resolver.HandleRunCommand([]string{"app"}); err != nil {
+			t.Fatalf("Error running resources: %v", err)
+		}
+	})
+
+	for _, line := range []string{"[dry-run] git describe\n", "[dry-run] make build\n"} {
+		if strings.Count(output, line) != 1 {
+			t.Errorf("Expected %q once in the output, got %q", line, output)
+		}
+	}
+}
+
+func TestStepExecIsExpanded(t *testing.T) {
+	resolver, err := NewGraphResolver(afero.NewMemMapFs(), log.New(nil), "", runnerexec.DryRunExecutor{})
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+	env := stepEnv{vars: []string{"STAGE=prod"}}
+
+	tests := []struct {
+		exec     string
+		strict   bool
+		expected string
+	}{
+		{"deploy ${STAGE} ${STAGE:-eu}", false, "[dry-run] deploy prod prod\n"},
+		{"for f in *; do echo $${f}; done", true, "[dry-run] for f in *; do echo ${f}; done\n"},
+		{"echo $HOME", true, "[dry-run] echo $HOME\n"},
+		{"deploy ${REGION}", true, "[dry-run] deploy ${REGION}\n"},
+		{"deploy ${REGION:-eu} ${STAGE:+-${STAGE}}", true, "[dry-run] deploy ${REGION:-eu} -prod\n"},
+		{"deploy ${REGION:?set REGION}", false, "[dry-run] deploy ${REGION:?set REGION}\n"},
+		{"deploy ${REGION:?set REGION}", true, ""},
+	}
+	for _, tt := range tests {
+		process.SetStrict(tt.strict)
+		var result runnerexec.CommandResult
+		output := captureOutput(func() {
+			result, err = resolver.executeAndLogCommand(RunStep{Name: "deploy", Exec: tt.exec}, "app", "app", env, &RunnerLogs{})
+		})
+		if tt.expected == "" {
+			if err == nil {
+				t.Errorf("%s: expected an expansion error, got none", tt.exec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.exec, err)
+		}
+		if result.Output != tt.expected || !strings.Contains(output, tt.expected) {
+			t.Errorf("%s: expected %q, got %q", tt.exec, tt.expected, result.Output)
+		}
+	}
+	process.SetStrict(false)
+}
+
+func TestStepExecLeavesShellVariables(t *testing.T) {
+	resolver, err := NewGraphResolver(afero.NewMemMapFs(), log.New(nil), "", runnerexec.LocalExecutor{})
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+	env := stepEnv{vars: []string{"STAGE=prod"}}
+
+	for _, strict := range []bool{false, true} {
+		process.SetStrict(strict)
+		var result runnerexec.CommandResult
+		captureOutput(func() {
+			result, err = resolver.executeAndLogCommand(RunStep{Name: "loop", Exec: `V=1.2; echo "v=${V} ${STAGE}"; for f in a b; do echo "f=${f}"; done`}, "app", "app", env, &RunnerLogs{})
+		})
+		if err != nil {
+			t.Errorf("strict %v: expected no error, got %v", strict, err)
+		}
+		if expected := "v=1.2 prod\nf=a\nf=b"; strings.TrimSpace(result.Output) != expected {
+			t.Errorf("strict %v: expected %q, got %q", strict, expected, result.Output)
+		}
+	}
+	process.SetStrict(false)
+}
+
+func TestStepStreamMatchesLogEntry(t *testing.T) {
+	entry := StepLog{name: "build", id: "app", command: "make", message: "first\nsecond"}
+
+	added := captureOutput(func() { (&RunnerLogs{}).Add(entry) })
+
+	logs := &RunnerLogs{}
+	streamed := captureOutput(func() {
+		stream := logs.Stream(entry)
+		stream.Write([]byte("fir"))
+		stream.Write([]byte("st\nsec"))
+		stream.Write([]byte("ond"))
+		stream.Finish("first\nsecond")
+	})
+
+	if streamed != added {
+		t.Errorf("Expected streamed output %q, got %q", added, streamed)
+	}
+	if got := logs.GetAllMessageString(); got != "first\nsecond" {
+		t.Errorf("Expected the whole output in the log, got %q", got)
+	}
+}
+
+func TestStepDirAndTimeoutApplyToExecChecks(t *testing.T) {
+	recorder := runnerexec.NewRecordingExecutor(runnerexec.LocalExecutor{})
+	resolver, err := NewGraphResolver(afero.NewMemMapFs(), log.New(nil), "", recorder)
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+
+	dir := t.TempDir()
+	resolver.Resources = []ResourceNodeEntry{
+		{Id: "build", Run: []RunStep{{
+			Name:    "compile",
+			Exec:    "touch artifact",
+			Dir:     dir,
+			Timeout: 5 * time.Second,
+			Expect:  []interface{}{"EXEC:test -f artifact && test -f ./artifact"},
+		}}},
+	}
+	resolver.ResourceDependencies["build"] = nil
+
+	captureOutput(func() {
+		resolver.HandleRunCommand([]string{"build"})
+	})
+
+	commands := recorder.Commands()
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 recorded commands, got %d", len(commands))
+	}
+	for _, cmd := range commands {
+		if cmd.Dir != dir || cmd.Timeout != 5*time.Second {
+			t.Errorf("Expected step dir and timeout, got %+v", cmd)
+		}
+	}
+}
+
+func TestStepOutputNormalization(t *testing.T) {
+	var steps []RunStep
+	err := yaml.Unmarshal([]byte(`
+- name: default
+- name: raw
+  normalize: false
+- name: folded
+  normalize:
+    whitespace: true
+    ansi: false
+`), &steps)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal steps: %v", err)
+	}
+
+	resolver, _ := setupEnvTestResolver(t)
+	output := "\x1b[32mready\x1b[0m   in  3s\r\n"
+
+	tests := []struct {
+		step        RunStep
+		expectation string
+		expectError bool
+	}{
+		{steps[0], "LINE:ready   in  3s", false},
+		{steps[1], "LINE:ready   in  3s", true},
+		{steps[1], "TEXT:\x1b[32mready", false},
+		{steps[2], "LINE:\x1b[32mready\x1b[0m in 3s", false},
+	}
+
+	for _, tt := range tests {
+		scope := resolver.ruleScope(nil, tt.step, stepEnv{})
+		scope.Output, scope.StepOutput = output, output
+		err := expect.Evaluate(scope, []string{tt.expectation})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%s %q: expected error %v, got %v", tt.step.Name, tt.expectation, tt.expectError, err)
+		}
+	}
+}
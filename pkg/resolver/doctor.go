@@ -0,0 +1,217 @@
+package resolver
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jjuliano/runner/pkg/expect"
+)
+
+// doctorRow is a line of the `runner doctor` matrix.
+type doctorRow struct {
+	resource string
+	step     string
+	rule     string
+	passed   bool
+	skipped  bool
+	reason   string
+}
+
+// HandleDoctorCommand evaluates the requires_env declarations and the check:
+// rules of the given resources and their dependencies, or of every resource,
+// without running any step. It prints a pass/fail matrix and fails when a
+// check fails.
+func (dr *DependencyResolver) HandleDoctorCommand(resources []string) error {
+	for _, resName := range resources {
+		if _, ok := dr.findResource(resName); !ok {
+			return fmt.Errorf("resource '%s' not found", resName)
+		}
+	}
+	if err := dr.prepareDotenv(); err != nil {
+		return err
+	}
+
+	client := &http.Client{}
+	var rows []doctorRow
+	for _, resNode := range dr.resourceClosure(resources) {
+		res, _ := dr.findResource(resNode)
+		rows = append(rows, dr.doctorResource(res, client)...)
+	}
+	dr.closeRemotes()
+
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "RESOURCE\tSTEP\tCHECK\tRESULT\tREASON")
+	failed, skipped, total := 0, 0, 0
+	for _, row := range rows {
+		result := "ok"
+		switch {
+		case row.skipped:
+			result = "skipped"
+		case !row.passed:
+			result = "FAILED"
+		}
+		if !strings.HasPrefix(row.rule, " ") {
+			total++
+			switch {
+			case row.skipped:
+				skipped++
+			case !row.passed:
+				failed++
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", row.resource, row.step, row.rule, result, strings.ReplaceAll(row.reason, "\n", " "))
+	}
+	w.Flush()
+
+	PrintMessage("%s", out.String())
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, total)
+	}
+	if skipped > 0 {
+		PrintMessage("%d of %d checks skipped, the others passed.\n", skipped, total)
+		return nil
+	}
+	PrintMessage("All %d checks passed.\n", total)
+	return nil
+}
+
+// doctorResource evaluates the checks of a resource, on each of its hosts.
+func (dr *DependencyResolver) doctorResource(res ResourceNodeEntry, client *http.Client) []doctorRow {
+	hosts, err := dr.ResourceHosts(res)
+	if err != nil {
+		return []doctorRow{{resource: res.Id, step: "hosts", reason: err.Error()}}
+	}
+	if len(hosts) == 0 {
+		return dr.doctorChecks(res, res.Id, client)
+	}
+
+	var rows []doctorRow
+	for _, host := range hosts {
+		label := res.Id + "@" + host
+		hostResolver, err := dr.onHost(host)
+		if err != nil {
+			rows = append(rows, doctorRow{resource: label, step: "connect", reason: err.Error()})
+			continue
+		}
+		rows = append(rows, hostResolver.doctorChecks(res, label, client)...)
+	}
+	return rows
+}
+
+// doctorChecks evaluates the requires_env declarations and the check: rules
+// of the steps of a resource, in the environment previewEnv composes, since
+// the exec: and input: declarations of env: blocks would run commands or
+// prompt for input.
+func (dr *DependencyResolver) doctorChecks(res ResourceNodeEntry, label string, client *http.Client) []doctorRow {
+	var rows []doctorRow
+
+	if len(res.RequiresEnv) > 0 {
+		env, err := dr.previewEnv(res, RunStep{})
+		if err != nil {
+			return append(rows, doctorRow{resource: label, step: "requires_env", reason: err.Error()})
+		}
+		resolvedLater := envVarNames(runtimeEnvVars(res.Env))
+		for _, required := range res.RequiresEnv {
+			row := doctorRow{resource: label, step: "requires_env", rule: required.Rule(), passed: true}
+			if slices.Contains(resolvedLater, required.Name) {
+				row.skipped, row.reason = true, "declared with exec: or input:"
+			} else if err := required.Evaluate(env.vars); err != nil {
+				row.passed, row.reason = false, err.Error()
+				if required.Desc != "" {
+					row.reason += " (" + required.Desc + ")"
+				}
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	for _, step := range res.Run {
+		rules, ok := step.Check.([]interface{})
+		if !ok {
+			continue
+		}
+		env, err := dr.previewEnv(res, step)
+		if err != nil {
+			rows = append(rows, doctorRow{resource: label, step: step.Name, reason: err.Error()})
+			continue
+		}
+		scope := dr.ruleScope(client, step, env)
+		scope.Once = true
+		scope.Export = nil
+
+		for _, rule := range doctorRules(rules) {
+			result := expect.EvaluateResult(scope, rule)
+			rows = appendResultRows(rows, label, step.Name, result, 0)
+		}
+	}
+	return rows
+}
+
+// doctorRules lists the preconditions among the check: rules a run
+// evaluates, flattening `expect:` items. Strings a run skips as unsupported
+// are left out, and so are the rules of the output or the exit status of a
+// step, and the groups containing them, since no step runs.
+func doctorRules(rules []interface{}) []interface{} {
+	var preconditions []interface{}
+	for _, rule := range rules {
+		if r, ok := rule.(map[interface{}]interface{}); ok {
+			if nested, ok := r["expect"].([]interface{}); ok {
+				preconditions = append(preconditions, doctorRules(nested)...)
+				continue
+			}
+		}
+		if r, ok := rule.(string); ok && !HasValidRulePrefix(r) {
+			continue
+		}
+		if isPrecondition(rule) {
+			preconditions = append(preconditions, rule)
+		}
+	}
+	return preconditions
+}
+
+// isPrecondition reports whether a rule checks the host or the environment
+// only, and not the output of a step.
+func isPrecondition(rule interface{}) bool {
+	switch r := rule.(type) {
+	case string:
+		return !expect.ChecksOutput(r)
+	case map[interface{}]interface{}:
+		// groups are preconditions when all their rules are, `http:` rules are
+		for _, value := range r {
+			nested, _ := value.([]interface{})
+			for _, child := range nested {
+				if !isPrecondition(child) {
+					return false
+				}
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// appendResultRows adds a result and, for groups, the results of its rules
+// indented below it.
+func appendResultRows(rows []doctorRow, resource, step string, result *expect.Result, depth int) []doctorRow {
+	row := doctorRow{
+		resource: resource,
+		step:     step,
+		rule:     strings.Repeat("  ", depth) + result.Rule,
+		passed:   result.Passed(),
+		skipped:  result.Skipped,
+	}
+	if result.Err != nil && len(result.Children) == 0 {
+		row.reason = result.Err.Error()
+	}
+	rows = append(rows, row)
+	for _, child := range result.Children {
+		rows = appendResultRows(rows, resource, step, child, depth+1)
+	}
+	return rows
+}
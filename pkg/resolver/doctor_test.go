@@ -0,0 +1,137 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+func TestHandleDoctorCommand(t *testing.T) {
+	resolver, recorder := setupEnvTestResolver(t)
+	t.Setenv("DOCTOR_STAGE", "staging")
+
+	var resources struct {
+		Resources []ResourceNodeEntry `yaml:"resources"`
+	}
+	err := yaml.Unmarshal([]byte(`
+resources:
+  - id: base
+    requires_env:
+      - name: DOCTOR_MISSING
+        desc: "Needed by the base image"
+    run:
+      - name: prepare
+        exec: "echo prepare"
+        check:
+          - "ENV:DOCTOR_STAGE=staging"
+          - "CMD:doctor-missing-command"
+  - id: app
+    requires:
+      - base
+    env:
+      - name: DOCTOR_REGION
+        value: "eu"
+      - name: DOCTOR_ENDPOINT
+        value: "https://${DOCTOR_REGION}.example.com"
+      - name: DOCTOR_VERSION
+        exec: "echo 1.0"
+    requires_env:
+      - DOCTOR_VERSION
+    run:
+      - name: deploy
+        exec: "echo deploy"
+        check:
+          - "ENV:DOCTOR_REGION=eu"
+          - "ENV:DOCTOR_ENDPOINT=https://eu.example.com"
+          - any:
+              - "ENV:DOCTOR_REGION=us"
+              - "ENV:DOCTOR_STAGE=staging"
+          - "TEXT:deployed"
+          - "RE:^ok$"
+          - '"deployed"'
+          - 0
+          - all:
+              - "ENV:DOCTOR_REGION=eu"
+              - "LINES:>=1"
+          - expect:
+              - "JSON:.status"
+  - id: unrelated
+    run:
+      - name: other
+        check:
+          - "ENV:DOCTOR_UNRELATED"
+`), &resources)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal resources: %v", err)
+	}
+	resolver.Resources = resources.Resources
+	for _, entry := range resolver.Resources {
+		resolver.ResourceDependencies[entry.Id] = entry.Requires
+	}
+
+	var doctorErr error
+	output := captureOutput(func() {
+		doctorErr = resolver.HandleDoctorCommand([]string{"app"})
+	})
+	if doctorErr == nil || doctorErr.Error() != "2 of 7 checks failed" {
+		t.Errorf("Expected '2 of 7 checks failed', got %v", doctorErr)
+	}
+	if commands := recorder.Commands(); len(commands) != 0 {
+		t.Errorf("Expected doctor to run no step, got %v", commands)
+	}
+
+	for _, expected := range []string{
+		"DOCTOR_MISSING",
+		"Needed by the base image",
+		"CMD:doctor-missing-command",
+		"ENV:DOCTOR_REGION=eu",
+		"ENV:DOCTOR_ENDPOINT=https://eu.example.com",
+		"  ENV:DOCTOR_STAGE=staging",
+		"ENV:DOCTOR_VERSION",
+		"declared with exec: or input:",
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected output to contain %q, got:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "DOCTOR_UNRELATED") {
+		t.Errorf("Expected resources outside the closure to be left out, got:\n%s", output)
+	}
+	for _, unexpected := range []string{"TEXT:", "RE:", "deployed", "LINES:", "JSON:"} {
+		if strings.Contains(output, unexpected) {
+			t.Errorf("Expected rules of the step output to be left out, got %q in:\n%s", unexpected, output)
+		}
+	}
+
+	if err := resolver.HandleDoctorCommand([]string{"nonexistent"}); err == nil {
+		t.Errorf("Expected error for unknown resource, got none")
+	}
+}
+
+func TestDoctorDotenvSeesBaseEnv(t *testing.T) {
+	resolver, _ := setupEnvTestResolver(t)
+	t.Setenv("DOCTOR_HOST", "db.internal")
+	afero.WriteFile(resolver.Fs, "global.env", []byte("DOCTOR_URL=https://${DOCTOR_HOST}/api\n"), 0644)
+	afero.WriteFile(resolver.Fs, "resource.env", []byte("DOCTOR_DB=\"${DOCTOR_HOST}:5432\"\n"), 0644)
+	resolver.Dotenv = []string{"global.env"}
+
+	resolver.Resources = []ResourceNodeEntry{{
+		Id:     "app",
+		Dotenv: DotenvFiles{"resource.env"},
+		Run: []RunStep{{
+			Name:  "deploy",
+			Check: []interface{}{"ENV:DOCTOR_URL=https://db.internal/api", "ENV:DOCTOR_DB=db.internal:5432"},
+		}},
+	}}
+	resolver.ResourceDependencies["app"] = nil
+
+	var doctorErr error
+	output := captureOutput(func() {
+		doctorErr = resolver.HandleDoctorCommand([]string{"app"})
+	})
+	if doctorErr != nil {
+		t.Errorf("Expected the dotenv files to expand with the base environment, got %v:\n%s", doctorErr, output)
+	}
+}
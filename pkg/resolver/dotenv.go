@@ -0,0 +1,218 @@
+package resolver
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/expect/process"
+	"github.com/spf13/afero"
+)
+
+// LoadDotenv reads .env files into KEY=value entries, later files overriding
+// earlier ones. `${NAME}` placeholders of unquoted and double quoted values
+// expand to the variables declared before them, then to env.
+func LoadDotenv(fs afero.Fs, paths []string, env []string) ([]string, error) {
+	var vars []string
+	for _, path := range paths {
+		data, err := afero.ReadFile(fs, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read dotenv file: %v", err)
+		}
+		fileVars, err := ParseDotenv(string(data), mergeEnv(env, vars...))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%v", path, err)
+		}
+		for _, kv := range fileVars {
+			if key, value, _ := strings.Cut(kv, "="); IsSecretName(key) {
+				AddSecret(value)
+			}
+		}
+		vars = mergeEnv(vars, fileVars...)
+	}
+	return vars, nil
+}
+
+// ParseDotenv parses the contents of a .env file into KEY=value entries:
+//
+//	# comments, and blank lines, are ignored
+//	export NAME=value          the export prefix is optional
+//	NAME=unquoted value        surrounding spaces and a trailing # comment are dropped
+//	NAME='single quoted'       taken as is, may span lines
+//	NAME="double quoted\n"     \n, \r, \t, \", \\ and \$ escapes, may span lines
+//
+// Errors start with the line number.
+func ParseDotenv(data string, env []string) ([]string, error) {
+	p := &dotenvParser{data: strings.ReplaceAll(data, "\r\n", "\n"), line: 1}
+	var vars []string
+	lookup := func(name string) (string, bool) { return lookupEnv(mergeEnv(env, vars...), name) }
+
+	for {
+		p.skipBlankAndComments()
+		if p.done() {
+			return vars, nil
+		}
+		line := p.line
+
+		key := p.until("=\n")
+		if !p.consume('=') {
+			return nil, fmt.Errorf("%d: expected NAME=value, got '%s'", line, strings.TrimSpace(key))
+		}
+		key = strings.TrimSpace(key)
+		if rest, ok := strings.CutPrefix(key, "export"); ok && rest != "" && strings.TrimLeft(rest, " \t") != rest {
+			key = strings.TrimSpace(rest)
+		}
+		if !isEnvName(key) {
+			return nil, fmt.Errorf("%d: invalid variable name '%s'", line, key)
+		}
+
+		p.skipSpaces()
+		value, err := p.value(lookup)
+		if err != nil {
+			return nil, fmt.Errorf("%d: %s: %v", line, key, err)
+		}
+		vars = mergeEnv(vars, key+"="+value)
+	}
+}
+
+// dotenvParser reads a .env file one declaration at a time.
+type dotenvParser struct {
+	data string
+	pos  int
+	line int
+}
+
+func (p *dotenvParser) done() bool { return p.pos >= len(p.data) }
+
+func (p *dotenvParser) peek() byte { return p.data[p.pos] }
+
+func (p *dotenvParser) next() byte {
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c
+}
+
+func (p *dotenvParser) consume(c byte) bool {
+	if !p.done() && p.peek() == c {
+		p.next()
+		return true
+	}
+	return false
+}
+
+// until reads up to, but not including, the first of the stop characters.
+func (p *dotenvParser) until(stop string) string {
+	start := p.pos
+	for !p.done() && !strings.ContainsRune(stop, rune(p.peek())) {
+		p.next()
+	}
+	return p.data[start:p.pos]
+}
+
+func (p *dotenvParser) skipSpaces() {
+	for !p.done() && (p.peek() == ' ' || p.peek() == '\t') {
+		p.next()
+	}
+}
+
+func (p *dotenvParser) skipBlankAndComments() {
+	for !p.done() {
+		switch p.peek() {
+		case ' ', '\t', '\n':
+			p.next()
+		case '#':
+			p.until("\n")
+		default:
+			return
+		}
+	}
+}
+
+// value reads a quoted or unquoted value and the rest of its line.
+func (p *dotenvParser) value(lookup func(string) (string, bool)) (string, error) {
+	if p.done() {
+		return "", nil
+	}
+
+	var value string
+	switch quote := p.peek(); quote {
+	case '\'':
+		p.next()
+		value = p.until("'")
+		if !p.consume('\'') {
+			return "", fmt.Errorf("unterminated single quoted value")
+		}
+	case '"':
+		p.next()
+		var b strings.Builder
+		for {
+			if p.done() {
+				return "", fmt.Errorf("unterminated double quoted value")
+			}
+			c := p.next()
+			if c == '"' {
+				break
+			}
+			if c == '\\' && !p.done() {
+				switch escaped := p.next(); escaped {
+				case 'n':
+					b.WriteByte('\n')
+				case 'r':
+					b.WriteByte('\r')
+				case 't':
+					b.WriteByte('\t')
+				case '$':
+					// keep the placeholder from being expanded
+					b.WriteByte('$')
+					if !p.done() && p.peek() == '{' {
+						b.WriteByte('$')
+					}
+				case '"', '\\':
+					b.WriteByte(escaped)
+				default:
+					b.WriteByte('\\')
+					b.WriteByte(escaped)
+				}
+				continue
+			}
+			b.WriteByte(c)
+		}
+		value = b.String()
+		var err error
+		if value, err = process.Expand(value, lookup); err != nil {
+			return "", err
+		}
+	default:
+		value = p.until("\n")
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		if i := strings.Index(value, "\t#"); i >= 0 {
+			value = value[:i]
+		}
+		return process.Expand(strings.TrimSpace(value), lookup)
+	}
+
+	// only a comment may follow a quoted value
+	p.skipSpaces()
+	if !p.done() && p.peek() != '\n' && p.peek() != '#' {
+		return "", fmt.Errorf("unexpected '%s' after quoted value", strings.TrimSpace(p.until("\n")))
+	}
+	p.until("\n")
+	return value, nil
+}
+
+// isEnvName reports whether name is a valid environment variable name.
+func isEnvName(name string) bool {
+	if name == "" || ('0' <= name[0] && name[0] <= '9') {
+		return false
+	}
+	for _, r := range name {
+		if r != '_' && (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+)
+
+func TestParseDotenv(t *testing.T) {
+	tests := []struct {
+		data        string
+		expected    []string
+		expectError bool
+	}{
+		{"A=1\nB = two words \n", []string{"A=1", "B=two words"}, false},
+		{"# comment\n\n  export A=1\nexport\tB=2\n", []string{"A=1", "B=2"}, false},
+		{"A=value # comment\nB=a#b\n", []string{"A=value", "B=a#b"}, false},
+		{"A='single $HOME ${X} \\n' # comment\n", []string{"A=single $HOME ${X} \\n"}, false},
+		{`A="line\nnext\t\"quoted\" \\ \$X"`, []string{"A=line\nnext\t\"quoted\" \\ $X"}, false},
+		{"A=\"first\nsecond\"\nB='x\ny'\n", []string{"A=first\nsecond", "B=x\ny"}, false},
+		{"A=1\r\nB=\"2\"\r\n", []string{"A=1", "B=2"}, false},
+		{"A=\nB=\"\"\n", []string{"A=", "B="}, false},
+		{"A=1\nB=${A}-${HOME}\nC=\"${MISSING:-default}\"\nD=$${A}\n", []string{"A=1", "B=1-/home/runner", "C=default", "D=${A}"}, false},
+		{"A=${MISSING:-x$$y}\nB=\"${MISSING:-$${A}}\"\nC=\"\\${A} costs \\$5\"\n", []string{"A=x$$y", "B=${A}", "C=${A} costs $5"}, false},
+		{"A=1\nA=2\n", []string{"A=2"}, false},
+		{"export=1\n", []string{"export=1"}, false},
+		{"A\n", nil, true},
+		{"1A=1\n", nil, true},
+		{"MY-VAR=1\n", nil, true},
+		{"A=\"unterminated\n", nil, true},
+		{"A='unterminated\n", nil, true},
+		{"A=\"quoted\" trailing\n", nil, true},
+		{"A=${REQUIRED:?set REQUIRED}\n", nil, true},
+	}
+
+	for _, tt := range tests {
+		vars, err := ParseDotenv(tt.data, []string{"HOME=/home/runner"})
+		if (err != nil) != tt.expectError {
+			t.Errorf("%q: expected error %v, got %v", tt.data, tt.expectError, err)
+		}
+		if strings.Join(vars, "|") != strings.Join(tt.expected, "|") {
+			t.Errorf("%q: expected %q, got %q", tt.data, tt.expected, vars)
+		}
+	}
+
+	if _, err := ParseDotenv("A=1\n\nB=\"x\" y\n", nil); err == nil || !strings.HasPrefix(err.Error(), "3: B:") {
+		t.Errorf("Expected the error to start with the line number, got %v", err)
+	}
+}
+
+func TestLoadDotenv(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, ".env", []byte("STAGE=staging\nREGION=eu\n"), 0644)
+	afero.WriteFile(fs, ".env.local", []byte("STAGE=dev\nURL=https://${STAGE}.${REGION}.example.com\n"), 0644)
+
+	vars, err := LoadDotenv(fs, []string{".env", ".env.local"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Join(vars, ",") != "STAGE=dev,REGION=eu,URL=https://dev.eu.example.com" {
+		t.Errorf("Expected later files to override earlier ones, got %v", vars)
+	}
+
+	if _, err := LoadDotenv(fs, []string{".env.missing"}, nil); err == nil {
+		t.Errorf("Expected error for a missing file, got none")
+	}
+}
@@ -0,0 +1,552 @@
+package resolver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/jjuliano/runner/pkg/expect"
+	"github.com/jjuliano/runner/pkg/expect/process"
+	"github.com/jjuliano/runner/pkg/runnerexec"
+	"github.com/spf13/afero"
+	"golang.org/x/term"
+)
+
+const (
+	// EnvModeInherit passes the environment of the runner process to steps.
+	EnvModeInherit = "inherit"
+	// EnvModeClean passes only the allowlisted variables of the runner process to steps.
+	EnvModeClean = "clean"
+)
+
+// cleanEnvDefaults are passed through in clean mode in addition to env_passthrough.
+var cleanEnvDefaults = []string{"PATH", "HOME", "USER", "TMPDIR", "RUNNER_ENV", "RUNNER_PARAMS*"}
+
+// stepEnv is the environment a step and its checks run with.
+type stepEnv struct {
+	// vars is the complete environment.
+	vars []string
+	// declared holds only the variables declared in the workflow or exported
+	// through $RUNNER_ENV, which is what remote hosts receive.
+	declared []string
+}
+
+// lookupEnv finds a variable in a list of KEY=value entries.
+func lookupEnv(env []string, name string) (string, bool) {
+	for i := len(env) - 1; i >= 0; i-- {
+		if key, value, ok := strings.Cut(env[i], "="); ok && key == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// mergeEnv returns env with the given KEY=value entries set, replacing earlier values.
+func mergeEnv(env []string, vars ...string) []string {
+	merged := make([]string, 0, len(env)+len(vars))
+	index := make(map[string]int)
+	for _, kv := range append(append([]string(nil), env...), vars...) {
+		key, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[key]; ok {
+			merged[i] = kv
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged
+}
+
+// passthroughEnv keeps the entries whose names match one of the patterns.
+func passthroughEnv(env []string, patterns []string) []string {
+	var kept []string
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, key); matched {
+				kept = append(kept, kv)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// baseEnv builds the inherited part of a step environment according to its env_mode.
+func (dr *DependencyResolver) baseEnv(res ResourceNodeEntry, step RunStep) ([]string, error) {
+	mode := EnvModeInherit
+	for _, m := range []string{dr.EnvMode, res.EnvMode, step.EnvMode} {
+		if m != "" {
+			mode = m
+		}
+	}
+
+	switch mode {
+	case EnvModeInherit:
+		return os.Environ(), nil
+	case EnvModeClean:
+		patterns := append(append(append(append([]string(nil), cleanEnvDefaults...), dr.EnvPassthrough...), res.EnvPassthrough...), step.EnvPassthrough...)
+		return passthroughEnv(os.Environ(), patterns), nil
+	default:
+		return nil, fmt.Errorf("unknown env_mode '%s', expected '%s' or '%s'", mode, EnvModeInherit, EnvModeClean)
+	}
+}
+
+// composeEnv builds the environment of a step of a resource from its inherited
+// environment, the dotenv files of runner.yml, the variables exported through
+// $RUNNER_ENV, and the resolved resource and step variables.
+func (dr *DependencyResolver) composeEnv(resNode string, step RunStep, stepVars []string) (stepEnv, error) {
+	res, _ := dr.findResource(resNode)
+
+	base, err := dr.baseEnv(res, step)
+	if err != nil {
+		return stepEnv{}, err
+	}
+
+	exported, err := ReadEnvFile(os.Getenv("RUNNER_ENV"))
+	if err != nil {
+		return stepEnv{}, err
+	}
+
+	declared := mergeEnv(dr.dotenvVars, exported...)
+	declared = mergeEnv(declared, dr.resourceVars[resNode]...)
+	declared = mergeEnv(declared, stepVars...)
+	return stepEnv{vars: mergeEnv(base, declared...), declared: declared}, nil
+}
+
+// commandEnv is the environment handed to the executor. Remote hosts keep
+// their own environment and only receive the declared variables.
+func (dr *DependencyResolver) commandEnv(env stepEnv) []string {
+	if dr.host != "" {
+		return env.declared
+	}
+	return env.vars
+}
+
+// prepareDotenv loads the dotenv files of runner.yml once, before any
+// resource runs, with the inherited environment of the env_mode of runner.yml.
+func (dr *DependencyResolver) prepareDotenv() error {
+	dr.dotenvVars = nil
+	if len(dr.Dotenv) == 0 {
+		return nil
+	}
+
+	base, err := dr.baseEnv(ResourceNodeEntry{}, RunStep{})
+	if err != nil {
+		return err
+	}
+	dr.dotenvVars, err = LoadDotenv(dr.Fs, dr.Dotenv, base)
+	return err
+}
+
+// prepareResourceEnv resolves the dotenv files and env declarations of a
+// resource once, before its steps run.
+func (dr *DependencyResolver) prepareResourceEnv(res ResourceNodeEntry) error {
+	delete(dr.resourceVars, res.Id)
+	if len(res.Env) == 0 && len(res.Dotenv) == 0 {
+		return nil
+	}
+
+	env, err := dr.composeEnv(res.Id, RunStep{}, nil)
+	if err != nil {
+		return err
+	}
+
+	vars, err := dr.declareEnv(res.Dotenv, res.Env, env)
+	if err != nil {
+		return err
+	}
+	dr.resourceVars[res.Id] = vars
+	return nil
+}
+
+// declareEnv resolves dotenv files, then env declarations, which see the
+// variables of the files and override them.
+func (dr *DependencyResolver) declareEnv(dotenv []string, envVars []EnvVar, env stepEnv) ([]string, error) {
+	fileVars, err := LoadDotenv(dr.Fs, dotenv, env.vars)
+	if err != nil {
+		return nil, err
+	}
+
+	vars, err := dr.ProcessResourceNodeEnvVarDeclarations(envVars, mergeEnv(dr.commandEnv(env), fileVars...))
+	if err != nil {
+		return nil, err
+	}
+	return mergeEnv(fileVars, vars...), nil
+}
+
+// previewEnv composes the environment a step of a resource will run with,
+// without running anything. The dotenv files and the `value:` and `file:`
+// declarations of the resource and of the step are resolved, `exec:` and
+// `input:` declarations, which would run commands or prompt, are left out.
+// Placeholders that fail to expand are replaced with an empty string.
+func (dr *DependencyResolver) previewEnv(res ResourceNodeEntry, step RunStep) (stepEnv, error) {
+	env, err := dr.composeEnv(res.Id, step, nil)
+	if err != nil {
+		return env, err
+	}
+
+	vars, err := dr.staticDeclarations(res.Dotenv, res.Env, env)
+	if err != nil {
+		return env, err
+	}
+	if env, err = dr.composeEnv(res.Id, step, vars); err != nil || (len(step.Env) == 0 && len(step.Dotenv) == 0) {
+		return env, err
+	}
+
+	stepVars, err := dr.staticDeclarations(step.Dotenv, step.Env, env)
+	if err != nil {
+		return env, err
+	}
+	return dr.composeEnv(res.Id, step, mergeEnv(vars, stepVars...))
+}
+
+// staticDeclarations resolves dotenv files and env declarations like
+// declareEnv, leaving out the declarations that run commands or prompt.
+func (dr *DependencyResolver) staticDeclarations(dotenv []string, envVars []EnvVar, env stepEnv) ([]string, error) {
+	declared, err := LoadDotenv(dr.Fs, dotenv, env.vars)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, envVar := range envVars {
+		visible := mergeEnv(dr.commandEnv(env), declared...)
+		var value string
+		switch {
+		case envVar.Exec != "" || envVar.Input != "":
+			continue
+		case envVar.File != "":
+			if value, err = dr.readEnvFile(envVar, visible); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %v", envVar.Name, err)
+			}
+		default:
+			value = process.ExpandVars(envVar.Value, func(name string) (string, bool) {
+				return lookupEnv(visible, name)
+			})
+		}
+		declared = mergeEnv(declared, envVar.Name+"="+value)
+	}
+	return declared, nil
+}
+
+// StepEnv resolves the env declarations of a step and returns the complete environment it runs with.
+func (dr *DependencyResolver) StepEnv(resNode string, step RunStep) ([]string, error) {
+	env, err := dr.resolveStepEnv(resNode, step)
+	return env.vars, err
+}
+
+func (dr *DependencyResolver) resolveStepEnv(resNode string, step RunStep) (stepEnv, error) {
+	env, err := dr.composeEnv(resNode, step, nil)
+	if err != nil || (len(step.Env) == 0 && len(step.Dotenv) == 0) {
+		return env, err
+	}
+
+	stepVars, err := dr.declareEnv(step.Dotenv, step.Env, env)
+	if err != nil {
+		return env, err
+	}
+	return dr.composeEnv(resNode, step, stepVars)
+}
+
+// refreshStepEnv rebuilds an already resolved step environment, picking up
+// variables exported through $RUNNER_ENV since it was resolved.
+func (dr *DependencyResolver) refreshStepEnv(resNode string, step RunStep, env stepEnv) (stepEnv, error) {
+	names := envVarNames(step.Env)
+	if len(step.Dotenv) > 0 {
+		fileVars, err := LoadDotenv(dr.Fs, step.Dotenv, env.vars)
+		if err != nil {
+			return env, err
+		}
+		for _, kv := range fileVars {
+			name, _, _ := strings.Cut(kv, "=")
+			names = append(names, name)
+		}
+	}
+
+	stepVars := passthroughEnv(env.declared, names)
+	return dr.composeEnv(resNode, step, stepVars)
+}
+
+// runtimeEnvVars returns the `exec:` and `input:` declarations, whose values
+// are only known once the resource runs.
+func runtimeEnvVars(envVars []EnvVar) []EnvVar {
+	var runtime []EnvVar
+	for _, envVar := range envVars {
+		if envVar.Exec != "" || envVar.Input != "" {
+			runtime = append(runtime, envVar)
+		}
+	}
+	return runtime
+}
+
+func envVarNames(envVars []EnvVar) []string {
+	names := make([]string, len(envVars))
+	for i, envVar := range envVars {
+		names[i] = envVar.Name
+	}
+	return names
+}
+
+// ProcessResourceNodeEnvVarDeclarations resolves env declarations into
+// KEY=value entries. Commands of `exec:` declarations run with env and the
+// variables declared before them, which `${NAME}` placeholders of `exec:` and
+// `value:` declarations expand to.
+func (dr *DependencyResolver) ProcessResourceNodeEnvVarDeclarations(envVars []EnvVar, env []string) ([]string, error) {
+	var declared []string
+	for _, envVar := range envVars {
+		var value string
+
+		if envVar.Exec != "" {
+			var result runnerexec.CommandResult
+			var ok bool
+
+			visible := mergeEnv(env, declared...)
+			command, err := process.ExpandCommand(envVar.Exec, func(name string) (string, bool) {
+				return lookupEnv(visible, name)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("environment variable %s: %v", envVar.Name, err)
+			}
+			resultChan := runnerexec.Execute(dr.Executor, runnerexec.Command{Exec: command, Env: visible}, nil)
+			result, ok = <-resultChan
+
+			if !ok {
+				LogErrorExit(fmt.Sprintf("Failed to set ENV VAR: '%s'", envVar.Exec), nil)
+			}
+			value = result.Output
+			if errors.Is(result.Err, runnerexec.ErrDryRun) {
+				// Announce the command, the variable stays empty
+				PrintMessage("%s", result.Output)
+				value = ""
+			}
+		} else if envVar.Input != "" {
+			fmt.Print(envVar.Input + ": ")
+
+			var err error
+			if envVar.Secret {
+				value, err = readSecretInput()
+			} else {
+				_, err = fmt.Scanln(&value)
+			}
+			if err != nil {
+				LogErrorExit(fmt.Sprintf("Failed to read input for environment variable %s: ", envVar.Name), err)
+			}
+		} else if envVar.File != "" {
+			var err error
+			if value, err = dr.readEnvFile(envVar, mergeEnv(env, declared...)); err != nil {
+				return nil, fmt.Errorf("environment variable %s: %v", envVar.Name, err)
+			}
+		} else {
+			var err error
+			value, err = process.Expand(envVar.Value, func(name string) (string, bool) {
+				return lookupEnv(mergeEnv(env, declared...), name)
+			})
+			if err != nil {
+				return nil, fmt.Errorf("environment variable %s: %v", envVar.Name, err)
+			}
+		}
+
+		if envVar.Secret || IsSecretName(envVar.Name) {
+			AddSecret(value)
+		}
+		declared = mergeEnv(declared, envVar.Name+"="+value)
+	}
+	return declared, nil
+}
+
+// readEnvFile reads the contents of the file of a `file:` declaration and
+// trims them. The path may be `$NAME` or contain `${NAME}` placeholders.
+func (dr *DependencyResolver) readEnvFile(envVar EnvVar, env []string) (string, error) {
+	lookup := func(name string) (string, bool) { return lookupEnv(env, name) }
+
+	path := envVar.File
+	if name, ok := strings.CutPrefix(path, "$"); ok && isEnvName(name) {
+		if path, _ = lookup(name); path == "" {
+			return "", fmt.Errorf("environment variable %s not set or empty", name)
+		}
+	} else {
+		var err error
+		if path, err = process.Expand(path, lookup); err != nil {
+			return "", err
+		}
+	}
+
+	data, err := afero.ReadFile(dr.Fs, path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	switch envVar.Trim {
+	case "", "newline":
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "space":
+		return strings.TrimSpace(string(data)), nil
+	case "none":
+		return string(data), nil
+	default:
+		return "", fmt.Errorf("unknown trim '%s', expected newline, space or none", envVar.Trim)
+	}
+}
+
+// readSecretInput reads a line from the terminal without echoing it.
+func readSecretInput() (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		var value string
+		_, err := fmt.Scanln(&value)
+		return value, err
+	}
+
+	value, err := term.ReadPassword(fd)
+	fmt.Println()
+	return string(value), err
+}
+
+// ReadEnvFile reads KEY=value entries from an environment file such as
+// $RUNNER_ENV. A missing path yields no entries.
+func ReadEnvFile(envFilePath string) ([]string, error) {
+	if envFilePath == "" {
+		return nil, nil
+	}
+
+	file, err := os.Open(envFilePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, LogError(fmt.Sprintf("Failed to open environment file: %s - %v", envFilePath, err), err)
+	}
+	defer file.Close()
+
+	var env []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid environment variable declaration: %s in file: %s", line, envFilePath)
+		}
+		value = strings.Trim(value, "\"")
+		if IsSecretName(key) {
+			AddSecret(value)
+		}
+		env = mergeEnv(env, key+"="+value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, LogError(fmt.Sprintf("Error reading environment file: %s - %v", envFilePath, err), err)
+	}
+	return env, nil
+}
+
+// ExportEnv appends a variable to $RUNNER_ENV, which shares it with the steps that follow.
+func ExportEnv(name, value string) error {
+	envFilePath := os.Getenv("RUNNER_ENV")
+	if envFilePath == "" {
+		return fmt.Errorf("RUNNER_ENV is not set")
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("value of %s spans multiple lines", name)
+	}
+
+	file, err := os.OpenFile(envFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if IsSecretName(name) {
+		AddSecret(value)
+	}
+	_, err = fmt.Fprintf(file, "%s=%s\n", name, value)
+	return err
+}
+
+// resourceClosure lists the given resources and their dependencies in the
+// order they run, or every resource when none is given.
+func (dr *DependencyResolver) resourceClosure(resources []string) []string {
+	var closure []string
+	if len(resources) == 0 {
+		for _, res := range dr.Resources {
+			closure = append(closure, res.Id)
+		}
+		return closure
+	}
+
+	visited := make(map[string]bool)
+	for _, resName := range resources {
+		closure = append(closure, dr.Graph.BuildDependencyStack(resName, visited)...)
+	}
+	return closure
+}
+
+// findResource looks up a resource by id.
+func (dr *DependencyResolver) findResource(id string) (ResourceNodeEntry, bool) {
+	for _, res := range dr.Resources {
+		if res.Id == id {
+			return res, true
+		}
+	}
+	return ResourceNodeEntry{Id: id}, false
+}
+
+// ValidateRequiredEnv checks the requires_env declarations of the given
+// resources and their dependencies, and reports every missing or invalid
+// variable at once.
+func (dr *DependencyResolver) ValidateRequiredEnv(resources []string) error {
+	if len(resources) == 0 {
+		return nil
+	}
+
+	var failures []string
+	for _, resNode := range dr.resourceClosure(resources) {
+		res, _ := dr.findResource(resNode)
+		if len(res.RequiresEnv) == 0 {
+			continue
+		}
+		env, err := dr.previewEnv(res, RunStep{})
+		if err != nil {
+			return err
+		}
+		resolvedLater := envVarNames(runtimeEnvVars(res.Env))
+		for _, required := range res.RequiresEnv {
+			if slices.Contains(resolvedLater, required.Name) {
+				continue
+			}
+			if err := required.Evaluate(env.vars); err != nil {
+				failures = append(failures, requiredEnvFailure(resNode, required, err))
+			}
+		}
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("missing or invalid environment variables:\n%s", strings.Join(failures, "\n"))
+	}
+	return nil
+}
+
+// Rule is the ENV: condition of the declaration.
+func (r RequiredEnv) Rule() string {
+	return "ENV:" + r.Name + r.Check
+}
+
+// Evaluate checks the declaration against the environment.
+func (r RequiredEnv) Evaluate(env []string) error {
+	return expect.Evaluate(&expect.Scope{Env: env}, []string{r.Rule()})
+}
+
+func requiredEnvFailure(resNode string, required RequiredEnv, err error) string {
+	failure := fmt.Sprintf("  - %s (required by %s", required.Name, resNode)
+	if required.Desc != "" {
+		failure += ": " + required.Desc
+	}
+	return failure + "): " + err.Error()
+}
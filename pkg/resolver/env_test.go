@@ -0,0 +1,438 @@
+package resolver
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/charmbracelet/log"
+	"github.com/jjuliano/runner/pkg/runnerexec"
+	"github.com/spf13/afero"
+	"gopkg.in/yaml.v2"
+)
+
+func setupEnvTestResolver(t *testing.T) (*DependencyResolver, *runnerexec.RecordingExecutor) {
+	envFile := filepath.Join(t.TempDir(), ".runner_env")
+	if err := os.WriteFile(envFile, nil, 0644); err != nil {
+		t.Fatalf("Failed to create env file: %v", err)
+	}
+	t.Setenv("RUNNER_ENV", envFile)
+
+	recorder := runnerexec.NewRecordingExecutor(runnerexec.LocalExecutor{})
+	resolver, err := NewGraphResolver(afero.NewMemMapFs(), log.New(nil), "", recorder)
+	if err != nil {
+		t.Fatalf("Failed to create dependency resolver: %v", err)
+	}
+	return resolver, recorder
+}
+
+// countingFs counts how many times each file is opened.
+type countingFs struct {
+	afero.Fs
+	opens map[string]int
+}
+
+func (fs *countingFs) Open(name string) (afero.File, error) {
+	fs.opens[name]++
+	return fs.Fs.Open(name)
+}
+
+func TestMergeAndLookupEnv(t *testing.T) {
+	env := mergeEnv([]string{"A=1", "B=2"}, "B=3", "C=4")
+	if strings.Join(env, ",") != "A=1,B=3,C=4" {
+		t.Errorf("Unexpected merged env: %v", env)
+	}
+
+	if value, ok := lookupEnv(env, "B"); !ok || value != "3" {
+		t.Errorf("Expected B=3, got %q, %v", value, ok)
+	}
+	if _, ok := lookupEnv(env, "D"); ok {
+		t.Errorf("Expected D to be missing")
+	}
+}
+
+func TestBaseEnvModes(t *testing.T) {
+	resolver, _ := setupEnvTestResolver(t)
+	t.Setenv("RUNNER_TEST_ALLOWED", "yes")
+	t.Setenv("RUNNER_TEST_LEAKED", "no")
+
+	env, err := resolver.baseEnv(ResourceNodeEntry{}, RunStep{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := lookupEnv(env, "RUNNER_TEST_LEAKED"); !ok {
+		t.Errorf("Expected inherit mode to pass the process environment")
+	}
+
+	res := ResourceNodeEntry{EnvMode: EnvModeClean, EnvPassthrough: []string{"RUNNER_TEST_ALLOW*"}}
+	env, err = resolver.baseEnv(res, RunStep{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := lookupEnv(env, "RUNNER_TEST_LEAKED"); ok {
+		t.Errorf("Expected clean mode to drop variables outside the allowlist")
+	}
+	if _, ok := lookupEnv(env, "RUNNER_TEST_ALLOWED"); !ok {
+		t.Errorf("Expected clean mode to keep allowlisted variables")
+	}
+	if _, ok := lookupEnv(env, "PATH"); !ok {
+		t.Errorf("Expected clean mode to keep PATH")
+	}
+
+	// A step can opt back into the full environment
+	env, _ = resolver.baseEnv(res, RunStep{EnvMode: EnvModeInherit})
+	if _, ok := lookupEnv(env, "RUNNER_TEST_LEAKED"); !ok {
+		t.Errorf("Expected step env_mode to override the resource")
+	}
+
+	if _, err := resolver.baseEnv(ResourceNodeEntry{EnvMode: "sandbox"}, RunStep{}); err == nil {
+		t.Errorf("Expected error for unknown env_mode, got none")
+	}
+}
+
+func TestStepEnvIsScoped(t *testing.T) {
+	resolver, recorder := setupEnvTestResolver(t)
+	resolver.Resources = []ResourceNodeEntry{
+		{
+			Id:  "first",
+			Env: []EnvVar{{Name: "RESOURCE_VAR", Value: "from resource"}},
+			Run: []RunStep{{
+				Name: "declare",
+				Exec: "echo $STEP_VAR",
+				Env: []EnvVar{
+					{Name: "STEP_VAR", Value: "from step"},
+					{Name: "DERIVED_VAR", Exec: "printf '%s!' \"$STEP_VAR\""},
+				},
+			}},
+		},
+		{Id: "second", Run: []RunStep{{Name: "inspect", Exec: "echo ${STEP_VAR:-unset}"}}},
+	}
+	for _, entry := range resolver.Resources {
+		resolver.ResourceDependencies[entry.Id] = entry.Requires
+	}
+
+	captureOutput(func() {
+		resolver.HandleRunCommand([]string{"first", "second"})
+	})
+
+	if _, ok := os.LookupEnv("STEP_VAR"); ok {
+		t.Errorf("Expected step variables not to leak into the process environment")
+	}
+
+	var first, second runnerexec.Command
+	for _, cmd := range recorder.Commands() {
+		switch cmd.Exec {
+		case "echo $STEP_VAR":
+			first = cmd
+		case "echo ${STEP_VAR:-unset}":
+			second = cmd
+		}
+	}
+
+	for name, expected := range map[string]string{"RESOURCE_VAR": "from resource", "STEP_VAR": "from step", "DERIVED_VAR": "from step!"} {
+		if value, _ := lookupEnv(first.Env, name); value != expected {
+			t.Errorf("Expected %s=%q in step env, got %q", name, expected, value)
+		}
+	}
+	if _, ok := lookupEnv(second.Env, "STEP_VAR"); ok {
+		t.Errorf("Expected step variables not to leak into other resources")
+	}
+	if _, ok := lookupEnv(second.Env, "RESOURCE_VAR"); ok {
+		t.Errorf("Expected resource variables not to leak into other resources")
+	}
+}
+
+func TestEnvValuesAreExpanded(t *testing.T) {
+	resolver, _ := setupEnvTestResolver(t)
+	env := []string{"HOME=/home/runner", "STAGE="}
+
+	vars, err := resolver.ProcessResourceNodeEnvVarDeclarations([]EnvVar{
+		{Name: "CACHE", Value: "${HOME}/.cache"},
+		{Name: "STAGE", Value: "${STAGE:-staging}"},
+		{Name: "RELEASE", Value: "app-${STAGE}${REGION:+-${REGION}}"},
+		{Name: "LITERAL", Value: "$${HOME}"},
+		{Name: "COMMAND", Exec: "printf %s ${STAGE}-$${HOME}"},
+	}, env)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for name, expected := range map[string]string{"CACHE": "/home/runner/.cache", "STAGE": "staging", "RELEASE": "app-staging", "LITERAL": "${HOME}", "COMMAND": "staging-/home/runner"} {
+		if value, _ := lookupEnv(vars, name); value != expected {
+			t.Errorf("Expected %s=%q, got %q", name, expected, value)
+		}
+	}
+
+	_, err = resolver.ProcessResourceNodeEnvVarDeclarations([]EnvVar{{Name: "CLUSTER", Value: "${KUBE_CLUSTER:?set KUBE_CLUSTER}"}}, env)
+	if err == nil || err.Error() != "environment variable CLUSTER: set KUBE_CLUSTER" {
+		t.Errorf("Expected the required variable error, got %v", err)
+	}
+}
+
+func TestEnvFileDeclarations(t *testing.T) {
+	resolver, _ := setupEnvTestResolver(t)
+	afero.WriteFile(resolver.Fs, "/secrets/token", []byte("  s3cr3t  \n\n"), 0644)
+	env := []string{"TOKEN_FILE=/secrets/token", "SECRETS=/secrets"}
+
+	vars, err := resolver.ProcessResourceNodeEnvVarDeclarations([]EnvVar{
+		{Name: "NEWLINE", File: "$TOKEN_FILE"},
+		{Name: "SPACE", File: "${SECRETS}/token", Trim: "space"},
+		{Name: "NONE", File: "/secrets/token", Trim: "none"},
+	}, env)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for name, expected := range map[string]string{"NEWLINE": "  s3cr3t  ", "SPACE": "s3cr3t", "NONE": "  s3cr3t  \n\n"} {
+		if value, _ := lookupEnv(vars, name); value != expected {
+			t.Errorf("Expected %s=%q, got %q", name, expected, value)
+		}
+	}
+
+	for _, envVar := range []EnvVar{
+		{Name: "MISSING", File: "/secrets/missing"},
+		{Name: "UNSET", File: "$UNSET_FILE"},
+		{Name: "TRIM", File: "/secrets/token", Trim: "all"},
+	} {
+		if _, err := resolver.ProcessResourceNodeEnvVarDeclarations([]EnvVar{envVar}, env); err == nil {
+			t.Errorf("%s: expected error, got none", envVar.Name)
+		}
+	}
+}
+
+func TestDotenvIsScoped(t *testing.T) {
+	resolver, recorder := setupEnvTestResolver(t)
+	counting := &countingFs{Fs: resolver.Fs, opens: make(map[string]int)}
+	resolver.Fs = counting
+	afero.WriteFile(resolver.Fs, "global.env", []byte("GLOBAL=yes\nSTAGE=global\n"), 0644)
+	afero.WriteFile(resolver.Fs, "resource.env", []byte("export STAGE=resource\nDB_URL=\"postgres://db/${STAGE}\"\n"), 0644)
+	afero.WriteFile(resolver.Fs, "step.env", []byte("STAGE='step'\n"), 0644)
+	resolver.Dotenv = []string{"global.env"}
+
+	var resources struct {
+		Resources []ResourceNodeEntry `yaml:"resources"`
+	}
+	err := yaml.Unmarshal([]byte(`
+resources:
+  - id: app
+    dotenv: resource.env
+    env:
+      - name: RELEASE
+        value: "app-${STAGE}"
+    run:
+      - name: migrate
+        exec: "echo migrate"
+        dotenv:
+          - step.env
+      - name: deploy
+        exec: "echo deploy"
+  - id: other
+    run:
+      - name: inspect
+        exec: "echo inspect"
+`), &resources)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal resources: %v", err)
+	}
+	resolver.Resources = resources.Resources
+	for _, entry := range resolver.Resources {
+		resolver.ResourceDependencies[entry.Id] = entry.Requires
+	}
+
+	captureOutput(func() {
+		resolver.HandleRunCommand([]string{"app", "other"})
+	})
+
+	expected := map[string]map[string]string{
+		"echo migrate": {"GLOBAL": "yes", "STAGE": "step", "DB_URL": "postgres://db/resource", "RELEASE": "app-resource"},
+		"echo deploy":  {"GLOBAL": "yes", "STAGE": "resource", "DB_URL": "postgres://db/resource"},
+		"echo inspect": {"GLOBAL": "yes", "STAGE": "global", "DB_URL": ""},
+	}
+	commands := recorder.Commands()
+	if len(commands) != len(expected) {
+		t.Fatalf("Expected %d commands, got %v", len(expected), commands)
+	}
+	for _, cmd := range commands {
+		for name, value := range expected[cmd.Exec] {
+			if actual, _ := lookupEnv(cmd.Env, name); actual != value {
+				t.Errorf("%s: expected %s=%q, got %q", cmd.Exec, name, value, actual)
+			}
+		}
+	}
+	if counting.opens["global.env"] != 1 {
+		t.Errorf("Expected global.env to be read once per run, got %d reads", counting.opens["global.env"])
+	}
+}
+
+func TestExportedEnvIsShared(t *testing.T) {
+	resolver, recorder := setupEnvTestResolver(t)
+	resolver.Resources = []ResourceNodeEntry{
+		{Id: "producer", Run: []RunStep{{Name: "export", Exec: "echo SHARED_VAR=shared >> $RUNNER_ENV"}}},
+		{Id: "consumer", EnvMode: EnvModeClean, Requires: []string{"producer"}, Run: []RunStep{{Name: "use", Exec: "echo $SHARED_VAR", Expect: []interface{}{"ENV:SHARED_VAR"}}}},
+	}
+	for _, entry := range resolver.Resources {
+		resolver.ResourceDependencies[entry.Id] = entry.Requires
+	}
+
+	captureOutput(func() {
+		resolver.HandleRunCommand([]string{"consumer"})
+	})
+
+	commands := recorder.Commands()
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 commands, got %d", len(commands))
+	}
+	if value, _ := lookupEnv(commands[1].Env, "SHARED_VAR"); value != "shared" {
+		t.Errorf("Expected exported variable in later steps, got %q", value)
+	}
+}
+
+func TestReadEnvFile(t *testing.T) {
+	envFile := filepath.Join(t.TempDir(), ".runner_env")
+	content := "# comment\nFOO=bar\n\nQUOTED=\"a b\"\nFOO=baz\n"
+	if err := os.WriteFile(envFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write env file: %v", err)
+	}
+
+	env, err := ReadEnvFile(envFile)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Join(env, ",") != "FOO=baz,QUOTED=a b" {
+		t.Errorf("Unexpected env: %v", env)
+	}
+
+	if env, err := ReadEnvFile(filepath.Join(t.TempDir(), "missing")); err != nil || env != nil {
+		t.Errorf("Expected no entries for a missing file, got %v, %v", env, err)
+	}
+}
+
+func TestExpectationCaptureGroupsAreExported(t *testing.T) {
+	resolver, recorder := setupEnvTestResolver(t)
+	resolver.Resources = []ResourceNodeEntry{
+		{Id: "probe", Run: []RunStep{
+			{Name: "version", Exec: `echo '{"version": "1.2.3"}'`, Expect: []interface{}{`RE:"version": "(?P<PROBED_VERSION>[\d.]+)"`, `JSON:.version == "1.2.3"`}},
+			{Name: "use", Exec: "echo $PROBED_VERSION"},
+		}},
+	}
+	resolver.ResourceDependencies["probe"] = nil
+
+	captureOutput(func() {
+		resolver.HandleRunCommand([]string{"probe"})
+	})
+
+	commands := recorder.Commands()
+	if len(commands) != 2 {
+		t.Fatalf("Expected 2 commands, got %d", len(commands))
+	}
+	if value, _ := lookupEnv(commands[1].Env, "PROBED_VERSION"); value != "1.2.3" {
+		t.Errorf("Expected captured variable in later steps, got %q", value)
+	}
+}
+
+func TestRequiredEnvIsValidatedBeforeTheFirstStep(t *testing.T) {
+	resolver, recorder := setupEnvTestResolver(t)
+	t.Setenv("DEPLOY_STAGE", "production")
+	t.Setenv("EMPTY_TOKEN", "")
+	t.Setenv("DEPLOY_PORT", "80")
+
+	var resources struct {
+		Resources []ResourceNodeEntry `yaml:"resources"`
+	}
+	err := yaml.Unmarshal([]byte(`
+resources:
+  - id: base
+    requires_env:
+      - DEPLOY_STAGE
+      - name: MISSING_VAR
+        desc: "Needed by the base image"
+    run:
+      - name: prepare
+        exec: "echo prepare"
+  - id: app
+    requires:
+      - base
+    requires_env:
+      - name: EMPTY_TOKEN
+        desc: "GitHub token with repo scope"
+        check: "!empty"
+      - name: DEPLOY_PORT
+        check: ">=1024"
+      - name: DEPLOY_STAGE
+        check: "~=^(staging|production)$"
+    run:
+      - name: deploy
+        exec: "echo deploy"
+`), &resources)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal resources: %v", err)
+	}
+	resolver.Resources = resources.Resources
+	for _, entry := range resolver.Resources {
+		resolver.ResourceDependencies[entry.Id] = entry.Requires
+	}
+
+	err = resolver.HandleRunCommand([]string{"app"})
+	if err == nil {
+		t.Fatalf("Expected missing environment variables to fail the run")
+	}
+	for _, expected := range []string{
+		"MISSING_VAR (required by base: Needed by the base image)",
+		"EMPTY_TOKEN (required by app: GitHub token with repo scope): environment variable 'EMPTY_TOKEN' is empty",
+		"DEPLOY_PORT (required by app): environment variable 'DEPLOY_PORT' is 80, expected >= 1024",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("Expected %q in the error, got %v", expected, err)
+		}
+	}
+	if strings.Contains(err.Error(), "DEPLOY_STAGE") {
+		t.Errorf("Expected satisfied variables not to be reported, got %v", err)
+	}
+	if len(recorder.Commands()) != 0 {
+		t.Errorf("Expected no step to run, got %+v", recorder.Commands())
+	}
+}
+
+func TestRequiredEnvSeesResourceEnvAndDotenv(t *testing.T) {
+	resolver, recorder := setupEnvTestResolver(t)
+	afero.WriteFile(resolver.Fs, "/app/.env", []byte("DB_HOST=db.internal\n"), 0644)
+	afero.WriteFile(resolver.Fs, "/app/token", []byte("s3cret\n"), 0644)
+
+	var resources struct {
+		Resources []ResourceNodeEntry `yaml:"resources"`
+	}
+	err := yaml.Unmarshal([]byte(`
+resources:
+  - id: app
+    dotenv:
+      - /app/.env
+    env:
+      - name: DB_URL
+        value: "postgres://${DB_HOST}/app"
+      - name: TOKEN
+        file: /app/token
+      - name: VERSION
+        exec: "echo 1.0"
+    requires_env:
+      - name: DB_URL
+        check: "~=^postgres://db.internal/"
+      - name: TOKEN
+        check: "!empty"
+      - DB_HOST
+      - VERSION
+    run:
+      - name: deploy
+        exec: "echo deploy"
+`), &resources)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal resources: %v", err)
+	}
+	resolver.Resources = resources.Resources
+	resolver.ResourceDependencies["app"] = nil
+
+	if err := resolver.ValidateRequiredEnv([]string{"app"}); err != nil {
+		t.Errorf("Expected the variables of the resource to satisfy requires_env, got %v", err)
+	}
+	if len(recorder.Commands()) != 0 {
+		t.Errorf("Expected no command to run during validation, got %+v", recorder.Commands())
+	}
+}
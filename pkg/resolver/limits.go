@@ -0,0 +1,34 @@
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// ExecLimits converts the step limits into the limits applied by the executor.
+func (l *StepLimits) ExecLimits() (runnerexec.Limits, error) {
+	if l == nil {
+		return runnerexec.Limits{}, nil
+	}
+
+	limits := runnerexec.Limits{
+		CPUSeconds: l.CPU,
+		NoFile:     l.NoFile,
+		NProc:      l.NProc,
+		OutputLog:  l.OutputLog,
+	}
+
+	var err error
+	if l.Memory != "" {
+		if limits.AddressSpace, err = runnerexec.ParseSize(l.Memory); err != nil {
+			return limits, fmt.Errorf("invalid memory limit: %w", err)
+		}
+	}
+	if l.Output != "" {
+		if limits.Output, err = runnerexec.ParseSize(l.Output); err != nil {
+			return limits, fmt.Errorf("invalid output limit: %w", err)
+		}
+	}
+	return limits, nil
+}
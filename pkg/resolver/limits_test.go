@@ -0,0 +1,28 @@
+package resolver
+
+import (
+	"testing"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+func TestStepLimitsExecLimits(t *testing.T) {
+	var unset *StepLimits
+	limits, err := unset.ExecLimits()
+	if err != nil || limits != (runnerexec.Limits{}) {
+		t.Errorf("Expected no limits for unset step limits, got %+v, %v", limits, err)
+	}
+
+	limits, err = (&StepLimits{CPU: 30, Memory: "1GiB", NoFile: 256, NProc: 64, Output: "1MB", OutputLog: "build.log"}).ExecLimits()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := runnerexec.Limits{CPUSeconds: 30, AddressSpace: 1 << 30, NoFile: 256, NProc: 64, Output: 1000000, OutputLog: "build.log"}
+	if limits != expected {
+		t.Errorf("Expected %+v, got %+v", expected, limits)
+	}
+
+	if _, err := (&StepLimits{Memory: "lots"}).ExecLimits(); err == nil {
+		t.Errorf("Expected error for invalid memory limit, got none")
+	}
+}
@@ -18,7 +18,7 @@ func shouldLog() bool {
 
 func LogErrorExit(message string, err error) {
 	if shouldLog() {
-		msg := fmt.Sprintf("❌ %s: %s", message, err)
+		msg := MaskSecrets(fmt.Sprintf("❌ %s: %s", message, err))
 		logger.Errorf(msg)
 	}
 	os.Exit(1)
@@ -26,7 +26,7 @@ func LogErrorExit(message string, err error) {
 
 func LogError(message string, err error) error {
 	if shouldLog() {
-		msg := fmt.Sprintf("❌ %s: %s", message, err)
+		msg := MaskSecrets(fmt.Sprintf("❌ %s: %s", message, err))
 		logger.Errorf(msg)
 		return fmt.Errorf(msg)
 	}
@@ -34,30 +34,30 @@ func LogError(message string, err error) error {
 }
 
 func LogInfo(message string) {
-	logger.Info(message)
+	logger.Info(MaskSecrets(message))
 }
 
 func LogDebug(message string) {
 	if shouldLog() {
-		logger.Debug(message)
+		logger.Debug(MaskSecrets(message))
 	}
 }
 
 func PrintMessage(format string, a ...interface{}) {
-	fmt.Printf(format, a...)
+	fmt.Print(MaskSecrets(fmt.Sprintf(format, a...)))
 }
 
 func Println(a ...interface{}) {
-	fmt.Println(a...)
+	fmt.Print(MaskSecrets(fmt.Sprintln(a...)))
 }
 
 func PrintError(message string, err error) {
-	fmt.Printf("%s: %v\n", message, err)
+	fmt.Print(MaskSecrets(fmt.Sprintf("%s: %v\n", message, err)))
 }
 
 func LogWarn(message string) {
 	if shouldLog() {
-		logger.Warn(message)
+		logger.Warn(MaskSecrets(message))
 	}
 }
 
@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"fmt"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+// ResourceHosts lists the remote hosts the steps of a resource run on. An
+// empty list means the resource runs locally.
+func (dr *DependencyResolver) ResourceHosts(res ResourceNodeEntry) ([]string, error) {
+	var hosts []string
+	if res.Host != "" {
+		hosts = append(hosts, res.Host)
+	}
+	if res.Hosts != "" {
+		group, ok := dr.Inventory[res.Hosts]
+		if !ok {
+			return nil, fmt.Errorf("inventory group '%s' of resource '%s' is not defined", res.Hosts, res.Id)
+		}
+		hosts = append(hosts, group...)
+	}
+	return hosts, nil
+}
+
+// onHost returns a view of the resolver that runs commands and checks on the given host.
+func (dr *DependencyResolver) onHost(target string) (*DependencyResolver, error) {
+	if _, dryRun := dr.Executor.(runnerexec.DryRunExecutor); dryRun {
+		// A dry run does not connect to the host either
+		hostResolver := *dr
+		hostResolver.host = target
+		return &hostResolver, nil
+	}
+
+	executor, ok := dr.remotes[target]
+	if !ok {
+		var err error
+		executor, err = runnerexec.NewSSHExecutor(target, dr.SSHConfig)
+		if err != nil {
+			return nil, err
+		}
+		dr.remotes[target] = executor
+	}
+
+	hostResolver := *dr
+	hostResolver.Executor = executor
+	hostResolver.host = target
+	return &hostResolver, nil
+}
+
+// remote returns the executor of the bound host, or nil when running locally.
+func (dr *DependencyResolver) remote() runnerexec.Executor {
+	if dr.host == "" {
+		return nil
+	}
+	return dr.Executor
+}
+
+// closeRemotes disconnects from every remote host used during a run.
+func (dr *DependencyResolver) closeRemotes() {
+	for target, executor := range dr.remotes {
+		if err := executor.Close(); err != nil {
+			LogWarn(fmt.Sprintf("Failed to close connection to '%s': %v", target, err))
+		}
+		delete(dr.remotes, target)
+	}
+}
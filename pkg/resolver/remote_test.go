@@ -0,0 +1,67 @@
+package resolver
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jjuliano/runner/pkg/runnerexec"
+)
+
+func TestResourceHosts(t *testing.T) {
+	resolver := setupTestResolver()
+	resolver.Inventory["web"] = []string{"deploy@web1", "deploy@web2:2222"}
+
+	testCases := []struct {
+		name     string
+		entry    ResourceNodeEntry
+		expected []string
+		hasError bool
+	}{
+		{"Local resource", ResourceNodeEntry{Id: "local"}, nil, false},
+		{"Single host", ResourceNodeEntry{Id: "single", Host: "db1"}, []string{"db1"}, false},
+		{"Inventory group", ResourceNodeEntry{Id: "group", Hosts: "web"}, []string{"deploy@web1", "deploy@web2:2222"}, false},
+		{"Unknown group", ResourceNodeEntry{Id: "unknown", Hosts: "missing"}, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			hosts, err := resolver.ResourceHosts(tc.entry)
+			if (err != nil) != tc.hasError {
+				t.Fatalf("Expected error %v, got %v", tc.hasError, err)
+			}
+			if strings.Join(hosts, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected hosts %v, got %v", tc.expected, hosts)
+			}
+		})
+	}
+}
+
+func TestFormatLogEntryWithHost(t *testing.T) {
+	entry := StepLog{id: "deploy", name: "restart", command: "systemctl restart app", message: "done", host: "web1"}
+
+	formatted := FormatLogEntry(entry)
+	if !strings.Contains(formatted, "🖥️  Host: web1\n📝 Command: systemctl restart app") {
+		t.Errorf("Expected host in log entry, got %q", formatted)
+	}
+
+	entry.host = ""
+	if strings.Contains(FormatLogEntry(entry), "Host:") {
+		t.Errorf("Expected no host line for local log entry")
+	}
+}
+
+func TestOnHostInDryRun(t *testing.T) {
+	resolver := setupTestResolver()
+	resolver.Executor = runnerexec.DryRunExecutor{}
+
+	hostResolver, err := resolver.onHost("deploy@web1.invalid")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := hostResolver.Executor.(runnerexec.DryRunExecutor); !ok || hostResolver.host != "deploy@web1.invalid" {
+		t.Errorf("Expected the dry run to continue on the host, got %T on '%s'", hostResolver.Executor, hostResolver.host)
+	}
+	if len(resolver.remotes) != 0 {
+		t.Errorf("Expected no connection in a dry run, got %v", resolver.remotes)
+	}
+}
@@ -2,8 +2,10 @@ package resolver
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/charmbracelet/log"
+	"github.com/jjuliano/runner/pkg/expect"
 	"github.com/jjuliano/runner/pkg/runnerexec"
 	"github.com/kdeps/kartographer/graph"
 	"github.com/spf13/afero"
@@ -18,16 +20,98 @@ type DependencyResolver struct {
 	Logger               *log.Logger
 	Graph                *graph.DependencyGraph
 	WorkDir              string
-	ShellSession         *runnerexec.ShellSession
+	Executor             runnerexec.Executor
+	Inventory            map[string][]string
+	SSHConfig            runnerexec.SSHConfig
+	EnvMode              string
+	EnvPassthrough       []string
+	// Dotenv lists the .env files every step sees the variables of.
+	Dotenv []string
+
+	// host is set on resolvers bound to a remote host with onHost.
+	host         string
+	remotes      map[string]*runnerexec.SSHExecutor
+	resourceVars map[string][]string
+	// dotenvVars holds the variables of the Dotenv files, loaded once per run
+	// by prepareDotenv.
+	dotenvVars []string
 }
 
 type RunStep struct {
-	Name   string      `yaml:"name"`
-	Exec   string      `yaml:"exec"`
-	Skip   interface{} `yaml:"skip"`
-	Check  interface{} `yaml:"check"`
-	Expect interface{} `yaml:"expect"`
-	Env    []EnvVar    `yaml:"env"`
+	Name           string      `yaml:"name"`
+	Exec           string      `yaml:"exec"`
+	Skip           interface{} `yaml:"skip"`
+	Check          interface{} `yaml:"check"`
+	Expect         interface{} `yaml:"expect"`
+	Env            []EnvVar    `yaml:"env"`
+	EnvMode        string      `yaml:"env_mode,omitempty"`
+	EnvPassthrough []string    `yaml:"env_passthrough,omitempty"`
+	Dotenv         DotenvFiles `yaml:"dotenv,omitempty"`
+	Limits         *StepLimits `yaml:"limits,omitempty"`
+	// Dir is the working directory of the step and its EXEC: checks.
+	Dir string `yaml:"dir,omitempty"`
+	// Timeout kills the step and its EXEC: checks when they run longer.
+	Timeout time.Duration `yaml:"timeout,omitempty"`
+	// Normalize overrides how the output is cleaned up before check: and expect: rules match it.
+	Normalize *OutputNormalization `yaml:"normalize,omitempty"`
+}
+
+// OutputNormalization switches the output normalizations of a step on or
+// off. Unset fields keep the defaults: escape sequences are stripped,
+// progress updates collapsed and line endings normalized, whitespace is kept.
+type OutputNormalization struct {
+	ANSI        *bool `yaml:"ansi,omitempty"`
+	Progress    *bool `yaml:"progress,omitempty"`
+	LineEndings *bool `yaml:"line_endings,omitempty"`
+	Whitespace  *bool `yaml:"whitespace,omitempty"`
+}
+
+// UnmarshalYAML accepts `false` to match the raw output and `true` for the
+// defaults, as well as a map.
+func (n *OutputNormalization) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var enabled bool
+	if err := unmarshal(&enabled); err == nil {
+		if enabled {
+			*n = OutputNormalization{}
+		} else {
+			*n = OutputNormalization{ANSI: &enabled, Progress: &enabled, LineEndings: &enabled}
+		}
+		return nil
+	}
+	type plain OutputNormalization
+	return unmarshal((*plain)(n))
+}
+
+// normalization returns the normalization the rules of a step use.
+func (n *OutputNormalization) normalization() expect.Normalization {
+	normalization := expect.DefaultNormalization()
+	if n == nil {
+		return normalization
+	}
+	for _, setting := range []struct {
+		value *bool
+		field *bool
+	}{
+		{n.ANSI, &normalization.StripANSI},
+		{n.Progress, &normalization.CollapseProgress},
+		{n.LineEndings, &normalization.LineEndings},
+		{n.Whitespace, &normalization.FoldWhitespace},
+	} {
+		if setting.value != nil {
+			*setting.field = *setting.value
+		}
+	}
+	return normalization
+}
+
+// StepLimits restricts the resources a step may use. Sizes accept units such as "512MB" or "2GiB".
+type StepLimits struct {
+	CPU       uint64 `yaml:"cpu,omitempty"`
+	Memory    string `yaml:"memory,omitempty"`
+	NoFile    uint64 `yaml:"nofile,omitempty"`
+	NProc     uint64 `yaml:"nproc,omitempty"`
+	Output    string `yaml:"output,omitempty"`
+	OutputLog string `yaml:"output_log,omitempty"`
 }
 
 type EnvVar struct {
@@ -35,7 +119,26 @@ type EnvVar struct {
 	Value string `yaml:"value,omitempty"`
 	Exec  string `yaml:"exec,omitempty"`
 	Input string `yaml:"input,omitempty"`
-	File  string `yaml:"file,omitempty"`
+	// File sets the variable to the contents of the file.
+	File string `yaml:"file,omitempty"`
+	// Trim is what is trimmed from the contents of File: "newline", the
+	// default, removes trailing line breaks, "space" surrounding whitespace
+	// and "none" nothing.
+	Trim   string `yaml:"trim,omitempty"`
+	Secret bool   `yaml:"secret,omitempty"`
+}
+
+// DotenvFiles are the paths of .env files.
+type DotenvFiles []string
+
+// UnmarshalYAML accepts a single path as well as a list.
+func (d *DotenvFiles) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var path string
+	if err := unmarshal(&path); err == nil {
+		*d = DotenvFiles{path}
+		return nil
+	}
+	return unmarshal((*[]string)(d))
 }
 
 type StepKey struct {
@@ -44,22 +147,59 @@ type StepKey struct {
 }
 
 type ResourceNodeEntry struct {
-	Id       string    `yaml:"id"`
-	Name     string    `yaml:"name"`
-	Desc     string    `yaml:"desc"`
-	Category string    `yaml:"category"`
-	Requires []string  `yaml:"requires"`
-	Run      []RunStep `yaml:"run"`
+	Id             string    `yaml:"id"`
+	Name           string    `yaml:"name"`
+	Desc           string    `yaml:"desc"`
+	Category       string    `yaml:"category"`
+	Requires       []string  `yaml:"requires"`
+	Run            []RunStep `yaml:"run"`
+	Host           string    `yaml:"host,omitempty"`
+	Hosts          string    `yaml:"hosts,omitempty"`
+	Env            []EnvVar  `yaml:"env,omitempty"`
+	EnvMode        string    `yaml:"env_mode,omitempty"`
+	EnvPassthrough []string  `yaml:"env_passthrough,omitempty"`
+	// Dotenv lists .env files whose variables the steps of the resource see.
+	Dotenv DotenvFiles `yaml:"dotenv,omitempty"`
+	// RequiresEnv is validated for all resources of a run before its first step.
+	RequiresEnv []RequiredEnv `yaml:"requires_env,omitempty"`
+}
+
+// RequiredEnv is a variable a resource needs from the environment runner starts in.
+type RequiredEnv struct {
+	Name string `yaml:"name"`
+	Desc string `yaml:"desc,omitempty"`
+	// Check is an ENV: condition on the value, i.e. `!empty`, `~=^ghp_` or `>=1024`.
+	Check string `yaml:"check,omitempty"`
 }
 
-func NewGraphResolver(fs afero.Fs, logger *log.Logger, workDir string, shellSession *runnerexec.ShellSession) (*DependencyResolver, error) {
+// UnmarshalYAML accepts a plain variable name as well as a map.
+func (r *RequiredEnv) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var name string
+	if err := unmarshal(&name); err == nil {
+		*r = RequiredEnv{Name: name}
+		return nil
+	}
+	type plain RequiredEnv
+	return unmarshal((*plain)(r))
+}
+
+// NewGraphResolver creates a resolver that runs commands with the given executor.
+// A nil executor runs commands in a local shell.
+func NewGraphResolver(fs afero.Fs, logger *log.Logger, workDir string, executor runnerexec.Executor) (*DependencyResolver, error) {
+	if executor == nil {
+		executor = runnerexec.LocalExecutor{}
+	}
+
 	dependencyResolver := &DependencyResolver{
 		Fs:                   fs,
 		ResourceDependencies: make(map[string][]string),
 		VisitedPaths:         make(map[string]bool),
 		Logger:               logger,
 		WorkDir:              workDir,
-		ShellSession:         shellSession,
+		Executor:             executor,
+		Inventory:            make(map[string][]string),
+		remotes:              make(map[string]*runnerexec.SSHExecutor),
+		resourceVars:         make(map[string][]string),
 	}
 
 	dependencyResolver.Graph = graph.NewDependencyGraph(fs, logger, dependencyResolver.ResourceDependencies)
@@ -0,0 +1,94 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// secretMask replaces secret values in everything runner prints.
+const secretMask = "***"
+
+// minSecretLength keeps very short values from masking unrelated output.
+const minSecretLength = 4
+
+// secretMasker keeps track of secret values and the names of variables that hold secrets.
+type secretMasker struct {
+	mu       sync.RWMutex
+	forms    []string
+	known    map[string]bool
+	patterns []string
+}
+
+var masker = &secretMasker{known: make(map[string]bool)}
+
+// SetSecretPatterns sets the glob patterns of variable names whose values are secret.
+func SetSecretPatterns(patterns []string) {
+	masker.mu.Lock()
+	defer masker.mu.Unlock()
+	masker.patterns = append([]string(nil), patterns...)
+}
+
+// IsSecretName reports whether a variable name matches one of the secret patterns.
+func IsSecretName(name string) bool {
+	masker.mu.RLock()
+	defer masker.mu.RUnlock()
+	for _, pattern := range masker.patterns {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// AddSecret registers a value to be masked, together with its base64 and URL encoded forms.
+func AddSecret(value string) {
+	var forms []string
+	for _, v := range []string{value, strings.TrimSpace(value)} {
+		if len(v) < minSecretLength {
+			continue
+		}
+		forms = append(forms,
+			v,
+			base64.StdEncoding.EncodeToString([]byte(v)),
+			base64.RawStdEncoding.EncodeToString([]byte(v)),
+			base64.URLEncoding.EncodeToString([]byte(v)),
+			base64.RawURLEncoding.EncodeToString([]byte(v)),
+			url.QueryEscape(v),
+			url.PathEscape(v),
+		)
+	}
+
+	masker.mu.Lock()
+	defer masker.mu.Unlock()
+	for _, form := range forms {
+		if !masker.known[form] {
+			masker.known[form] = true
+			masker.forms = append(masker.forms, form)
+		}
+	}
+	// Replace longer forms first so a secret inside another one is fully masked.
+	sort.Slice(masker.forms, func(i, j int) bool { return len(masker.forms[i]) > len(masker.forms[j]) })
+}
+
+// AddSecretEnv registers the values of KEY=value entries whose names match a secret pattern.
+func AddSecretEnv(env []string) {
+	for _, kv := range env {
+		if key, value, ok := strings.Cut(kv, "="); ok && IsSecretName(key) {
+			AddSecret(value)
+		}
+	}
+}
+
+// MaskSecrets replaces every registered secret in s.
+func MaskSecrets(s string) string {
+	masker.mu.RLock()
+	defer masker.mu.RUnlock()
+	for _, form := range masker.forms {
+		s = strings.ReplaceAll(s, form, secretMask)
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package resolver
+
+import (
+	"encoding/base64"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMaskSecrets(t *testing.T) {
+	secret := "s3cr3t/token+value"
+	AddSecret(secret + "\n")
+
+	testCases := []struct {
+		name  string
+		input string
+	}{
+		{"Raw value", "token is " + secret},
+		{"Base64", "Authorization: Basic " + base64.StdEncoding.EncodeToString([]byte(secret))},
+		{"URL base64", base64.RawURLEncoding.EncodeToString([]byte(secret))},
+		{"Query escaped", "https://example.com/?token=" + url.QueryEscape(secret)},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			masked := MaskSecrets(tc.input)
+			if !strings.Contains(masked, secretMask) {
+				t.Errorf("Expected secret to be masked in %q", masked)
+			}
+			if strings.Contains(masked, secret) {
+				t.Errorf("Expected no secret in %q", masked)
+			}
+		})
+	}
+
+	if MaskSecrets("nothing to hide") != "nothing to hide" {
+		t.Errorf("Expected output without secrets to be unchanged")
+	}
+
+	AddSecret("ab")
+	if MaskSecrets("abc") != "abc" {
+		t.Errorf("Expected very short values not to be masked")
+	}
+}
+
+func TestSecretPatterns(t *testing.T) {
+	SetSecretPatterns([]string{"*_TOKEN", "DB_PASSWORD"})
+	defer SetSecretPatterns(nil)
+
+	if !IsSecretName("GH_TOKEN") || !IsSecretName("DB_PASSWORD") || IsSecretName("HOME") {
+		t.Errorf("Unexpected secret name matching")
+	}
+
+	AddSecretEnv([]string{"GH_TOKEN=ghp_patternsecret", "HOME=/home/runner"})
+	if masked := MaskSecrets("ghp_patternsecret /home/runner"); masked != "*** /home/runner" {
+		t.Errorf("Expected only the token to be masked, got %q", masked)
+	}
+}
+
+func TestSecretEnvVarIsMaskedInLogs(t *testing.T) {
+	resolver, _ := setupEnvTestResolver(t)
+
+	vars, err := resolver.ProcessResourceNodeEnvVarDeclarations([]EnvVar{{Name: "API_KEY", Exec: "echo declared-secret-value", Secret: true}}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if value, _ := lookupEnv(vars, "API_KEY"); value != "declared-secret-value\n" {
+		t.Errorf("Expected the step to receive the real value, got %q", value)
+	}
+
+	logs := &RunnerLogs{}
+	output := captureOutput(func() {
+		logs.Add(StepLog{id: "deploy", name: "push", command: "echo $API_KEY", message: "declared-secret-value\n"})
+	})
+	if strings.Contains(output, "declared-secret-value") || strings.Contains(logs.GetAllMessageString(), "declared-secret-value") {
+		t.Errorf("Expected secret to be masked in logs, got %q", output)
+	}
+}
@@ -0,0 +1,277 @@
+package runnerexec
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Command describes a single command handed to an Executor.
+type Command struct {
+	Exec string
+	// Env is the complete environment of the command. A nil Env inherits the
+	// environment of the runner process.
+	Env []string
+	// Dir is the working directory of the command. An empty Dir uses the
+	// working directory of the runner process.
+	Dir string
+	// Limits restricts the resources the command may use.
+	Limits Limits
+	// Timeout kills the command when it runs longer. Zero means no timeout.
+	Timeout time.Duration
+}
+
+// Executor starts commands on behalf of the resolver.
+type Executor interface {
+	// Start launches the command without waiting for it to finish. When stream
+	// is not nil, output is copied to it as it is produced.
+	Start(cmd Command, stream io.Writer) (Process, error)
+}
+
+// Process is a command started by an Executor.
+type Process interface {
+	// Wait blocks until the command finishes and returns its result.
+	Wait() CommandResult
+	// Kill terminates the command.
+	Kill() error
+}
+
+// Execute starts the command with the given executor and delivers its result
+// on the returned channel. When stream is not nil, it receives the output while
+// the command runs.
+func Execute(e Executor, cmd Command, stream io.Writer) <-chan CommandResult {
+	resultChan := make(chan CommandResult, 1)
+
+	go func() {
+		defer close(resultChan)
+
+		proc, err := e.Start(cmd, stream)
+		if err != nil {
+			resultChan <- CommandResult{ExitCode: -1, Err: err}
+			return
+		}
+		resultChan <- waitWithTimeout(proc, cmd.Timeout)
+	}()
+
+	return resultChan
+}
+
+// waitWithTimeout waits for the process, killing it once the timeout passes.
+func waitWithTimeout(proc Process, timeout time.Duration) CommandResult {
+	if timeout <= 0 {
+		return proc.Wait()
+	}
+
+	var timedOut atomic.Bool
+	timer := time.AfterFunc(timeout, func() {
+		timedOut.Store(true)
+		proc.Kill()
+	})
+	result := proc.Wait()
+	timer.Stop()
+
+	if timedOut.Load() {
+		result.Err = fmt.Errorf("command timed out after %s", timeout)
+		if result.ExitCode == 0 {
+			result.ExitCode = -1
+		}
+	}
+	return result
+}
+
+// LocalExecutor runs commands with `sh -c` on the local machine.
+type LocalExecutor struct{}
+
+// Start launches the command in a local shell.
+func (LocalExecutor) Start(command Command, stream io.Writer) (Process, error) {
+	proc := &localProcess{cmd: exec.Command("sh", "-c", limitCommand(command.Exec, command.Limits))}
+	proc.cmd.Env = command.Env
+	proc.cmd.Dir = command.Dir
+	setProcessGroup(proc.cmd)
+	if command.Timeout > 0 {
+		// Do not wait for children of a killed shell that still hold its output open
+		proc.cmd.WaitDelay = time.Second
+	}
+
+	var stdout, stderr io.Writer = &proc.outbuf, &proc.errbuf
+	if command.Limits.Output > 0 {
+		proc.capped = newCappedOutput(command.Limits)
+		stdout, stderr = proc.capped, proc.capped
+	}
+	if stream != nil {
+		stream = &syncWriter{w: stream}
+		stdout, stderr = io.MultiWriter(stdout, stream), io.MultiWriter(stderr, stream)
+	}
+	proc.cmd.Stdout, proc.cmd.Stderr = stdout, stderr
+
+	if err := proc.cmd.Start(); err != nil {
+		return nil, err
+	}
+	trackProcessGroup(proc.cmd.Process.Pid)
+	return proc, nil
+}
+
+type localProcess struct {
+	cmd            *exec.Cmd
+	outbuf, errbuf bytes.Buffer
+	capped         *cappedOutput
+}
+
+func (p *localProcess) Wait() CommandResult {
+	err := p.cmd.Wait()
+	untrackProcessGroup(p.cmd.Process.Pid)
+	output := p.outbuf.String() + p.errbuf.String()
+	if p.capped != nil {
+		output = p.capped.String()
+	}
+	exitCode := 0
+
+	if err != nil {
+		if exitError, ok := err.(*exec.ExitError); ok {
+			exitCode = exitError.ExitCode()
+		}
+	}
+
+	return CommandResult{Output: output, ExitCode: exitCode, Err: err}
+}
+
+// Kill kills the shell together with the commands it started, which would
+// otherwise keep its output open.
+func (p *localProcess) Kill() error {
+	return signalProcessGroup(p.cmd.Process.Pid, true)
+}
+
+var (
+	processGroupsMu sync.Mutex
+	// processGroups holds the process group IDs of the local commands still running.
+	processGroups = make(map[int]bool)
+)
+
+func trackProcessGroup(pid int) {
+	processGroupsMu.Lock()
+	defer processGroupsMu.Unlock()
+	processGroups[pid] = true
+}
+
+func untrackProcessGroup(pid int) {
+	processGroupsMu.Lock()
+	defer processGroupsMu.Unlock()
+	delete(processGroups, pid)
+}
+
+// StopProcessGroups terminates the local commands still running, together
+// with the commands they started, and kills the ones that have not exited
+// after grace. Commands run in process groups of their own, so a signal sent
+// to the runner does not reach them.
+func StopProcessGroups(grace time.Duration) {
+	processGroupsMu.Lock()
+	pids := make([]int, 0, len(processGroups))
+	for pid := range processGroups {
+		pids = append(pids, pid)
+	}
+	processGroupsMu.Unlock()
+
+	for _, pid := range pids {
+		signalProcessGroup(pid, false)
+	}
+	deadline := time.Now().Add(grace)
+	for _, pid := range pids {
+		for processGroupAlive(pid) && time.Now().Before(deadline) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if processGroupAlive(pid) {
+			signalProcessGroup(pid, true)
+		}
+	}
+}
+
+// syncWriter serializes writes from the stdout and stderr copiers.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
+
+// ErrDryRun is the error of the commands a DryRunExecutor did not run.
+var ErrDryRun = errors.New("command not run in dry run")
+
+// DryRunExecutor reports commands instead of running them. Every command
+// exits with status 0 and ErrDryRun, its output is the `[dry-run]` line.
+type DryRunExecutor struct{}
+
+// Start announces the command on stream and returns a finished process.
+func (DryRunExecutor) Start(cmd Command, stream io.Writer) (Process, error) {
+	announcement := fmt.Sprintf("[dry-run] %s\n", cmd.Exec)
+	if stream != nil {
+		io.WriteString(stream, announcement)
+	}
+	return finishedProcess{result: CommandResult{Output: announcement, Err: ErrDryRun}}, nil
+}
+
+type finishedProcess struct {
+	result CommandResult
+}
+
+func (p finishedProcess) Wait() CommandResult { return p.result }
+
+func (p finishedProcess) Kill() error { return nil }
+
+// RecordingExecutor captures every command it is asked to start, together
+// with the environment and working directory it would run with, before
+// handing it to the next executor.
+type RecordingExecutor struct {
+	// Next runs the recorded commands. When nil, commands are only recorded.
+	Next Executor
+
+	mu       sync.Mutex
+	commands []Command
+}
+
+// NewRecordingExecutor creates a RecordingExecutor in front of next.
+func NewRecordingExecutor(next Executor) *RecordingExecutor {
+	return &RecordingExecutor{Next: next}
+}
+
+// Start records the command and starts it with the next executor.
+func (r *RecordingExecutor) Start(cmd Command, stream io.Writer) (Process, error) {
+	recorded := cmd
+	if recorded.Env == nil {
+		recorded.Env = os.Environ()
+	} else {
+		recorded.Env = append([]string(nil), cmd.Env...)
+	}
+	if recorded.Dir == "" {
+		if wd, err := os.Getwd(); err == nil {
+			recorded.Dir = wd
+		}
+	}
+
+	r.mu.Lock()
+	r.commands = append(r.commands, recorded)
+	r.mu.Unlock()
+
+	if r.Next == nil {
+		return finishedProcess{}, nil
+	}
+	return r.Next.Start(cmd, stream)
+}
+
+// Commands returns the recorded commands in the order they were started.
+func (r *RecordingExecutor) Commands() []Command {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	commands := make([]Command, len(r.commands))
+	copy(commands, r.commands)
+	return commands
+}
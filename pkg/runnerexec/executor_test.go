@@ -0,0 +1,197 @@
+package runnerexec
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLocalExecutorStream(t *testing.T) {
+	var stream bytes.Buffer
+
+	proc, err := LocalExecutor{}.Start(Command{Exec: "echo streamed"}, &stream)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	result := proc.Wait()
+	if result.Err != nil {
+		t.Fatalf("expected no error, got %v", result.Err)
+	}
+	if result.Output != "streamed\n" {
+		t.Errorf("expected output %q, got %q", "streamed\n", result.Output)
+	}
+	if stream.String() != "streamed\n" {
+		t.Errorf("expected streamed output %q, got %q", "streamed\n", stream.String())
+	}
+}
+
+func TestLocalExecutorEnvAndDir(t *testing.T) {
+	dir, err := os.MkdirTemp("", "executor")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	result := <-Execute(LocalExecutor{}, Command{
+		Exec: "echo $GREETING; pwd",
+		Env:  []string{"GREETING=hello"},
+		Dir:  dir,
+	}, nil)
+	if result.Err != nil {
+		t.Fatalf("expected no error, got %v", result.Err)
+	}
+	if !strings.HasPrefix(result.Output, "hello\n") || !strings.Contains(result.Output, dir) {
+		t.Errorf("expected env and working directory in output, got %q", result.Output)
+	}
+}
+
+func TestExecuteStreamsOutput(t *testing.T) {
+	var stream bytes.Buffer
+
+	result := <-Execute(LocalExecutor{}, Command{Exec: "echo streamed"}, &stream)
+	if result.Err != nil {
+		t.Fatalf("expected no error, got %v", result.Err)
+	}
+	if stream.String() != "streamed\n" || result.Output != "streamed\n" {
+		t.Errorf("expected the output on the stream and in the result, got %q and %q", stream.String(), result.Output)
+	}
+}
+
+func TestLocalExecutorKill(t *testing.T) {
+	// The children of the shell hold its output open until they are killed too
+	proc, err := LocalExecutor{}.Start(Command{Exec: "sleep 30 | cat; sleep 30"}, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	start := time.Now()
+	if err := proc.Kill(); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	result := proc.Wait()
+	if result.Err == nil {
+		t.Errorf("expected error from killed process, got none")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("expected killed process to exit promptly")
+	}
+}
+
+func TestExecuteTimeout(t *testing.T) {
+	start := time.Now()
+	result := <-Execute(LocalExecutor{}, Command{Exec: "echo started; sleep 30 | cat", Timeout: 100 * time.Millisecond}, nil)
+	if result.Err == nil || !strings.Contains(result.Err.Error(), "timed out") {
+		t.Errorf("expected timeout error, got %v", result.Err)
+	}
+	if result.ExitCode == 0 {
+		t.Errorf("expected non-zero exit code, got 0")
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Errorf("expected timed out command to stop promptly")
+	}
+
+	result = <-Execute(LocalExecutor{}, Command{Exec: "echo fast", Timeout: 10 * time.Second}, nil)
+	if result.Err != nil || result.Output != "fast\n" {
+		t.Errorf("expected command to finish before the timeout, got %q, %v", result.Output, result.Err)
+	}
+}
+
+func TestDryRunExecutor(t *testing.T) {
+	var stream bytes.Buffer
+
+	proc, err := DryRunExecutor{}.Start(Command{Exec: "rm -rf /tmp/should-not-run"}, &stream)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	result := proc.Wait()
+	if !errors.Is(result.Err, ErrDryRun) || result.ExitCode != 0 || result.Output != "[dry-run] rm -rf /tmp/should-not-run\n" {
+		t.Errorf("expected a dry-run result with the announcement, got %+v", result)
+	}
+	if stream.String() != "[dry-run] rm -rf /tmp/should-not-run\n" {
+		t.Errorf("unexpected dry-run output %q", stream.String())
+	}
+}
+
+func TestRecordingExecutor(t *testing.T) {
+	t.Run("Records without executing", func(t *testing.T) {
+		recorder := NewRecordingExecutor(nil)
+
+		result := <-Execute(recorder, Command{Exec: "touch /tmp/should-not-exist", Env: []string{"A=1"}, Dir: "/tmp"}, nil)
+		if result.Err != nil {
+			t.Fatalf("expected no error, got %v", result.Err)
+		}
+
+		commands := recorder.Commands()
+		if len(commands) != 1 {
+			t.Fatalf("expected 1 recorded command, got %d", len(commands))
+		}
+		if commands[0].Exec != "touch /tmp/should-not-exist" || commands[0].Dir != "/tmp" || len(commands[0].Env) != 1 || commands[0].Env[0] != "A=1" {
+			t.Errorf("unexpected recorded command %+v", commands[0])
+		}
+	})
+
+	t.Run("Fills inherited env and cwd", func(t *testing.T) {
+		recorder := NewRecordingExecutor(LocalExecutor{})
+
+		result := <-Execute(recorder, Command{Exec: "echo recorded"}, nil)
+		if result.Output != "recorded\n" {
+			t.Errorf("expected output %q, got %q", "recorded\n", result.Output)
+		}
+
+		wd, _ := os.Getwd()
+		commands := recorder.Commands()
+		if len(commands) != 1 || commands[0].Dir != wd || len(commands[0].Env) != len(os.Environ()) {
+			t.Errorf("expected inherited env and cwd to be recorded, got %+v", commands)
+		}
+	})
+}
+
+func TestStopProcessGroups(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("process groups are only used on Unix")
+	}
+
+	var procs []Process
+	var pids []int
+	// the second command ignores SIGTERM and is only stopped by SIGKILL
+	for _, command := range []string{"sleep 30 & sleep 30 & wait", "trap '' TERM; sleep 30 & wait"} {
+		proc, err := LocalExecutor{}.Start(Command{Exec: command}, nil)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", command, err)
+		}
+		procs = append(procs, proc)
+		pids = append(pids, proc.(*localProcess).cmd.Process.Pid)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	StopProcessGroups(200 * time.Millisecond)
+	for i, proc := range procs {
+		if result := proc.Wait(); result.Err == nil {
+			t.Errorf("expected command %d to be stopped, got %+v", i, result)
+		}
+		// killed children are reaped by init, give it a moment
+		for wait := time.Now(); processGroupAlive(pids[i]) && time.Since(wait) < 5*time.Second; {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if processGroupAlive(pids[i]) {
+			t.Errorf("expected the process group of command %d to be gone", i)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 15*time.Second {
+		t.Errorf("expected the commands to stop promptly, took %v", elapsed)
+	}
+
+	processGroupsMu.Lock()
+	defer processGroupsMu.Unlock()
+	if len(processGroups) != 0 {
+		t.Errorf("expected no process group left, got %v", processGroups)
+	}
+}
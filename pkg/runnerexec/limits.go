@@ -0,0 +1,138 @@
+package runnerexec
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Limits restricts the resources a command may use. Zero values mean unlimited.
+// CPU, address space, open files and process limits are applied on Linux only.
+type Limits struct {
+	CPUSeconds   uint64
+	AddressSpace uint64
+	NoFile       uint64
+	NProc        uint64
+	// Output caps how many bytes of output are held in memory. Anything
+	// beyond it is written to OutputLog together with the rest of the output.
+	Output uint64
+	// OutputLog is where the full output is spilled. A temporary file is
+	// created when empty.
+	OutputLog string
+}
+
+func (l Limits) hasRlimits() bool {
+	return l.CPUSeconds != 0 || l.AddressSpace != 0 || l.NoFile != 0 || l.NProc != 0
+}
+
+var sizeUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"K":   1 << 10,
+	"KB":  1e3,
+	"KIB": 1 << 10,
+	"M":   1 << 20,
+	"MB":  1e6,
+	"MIB": 1 << 20,
+	"G":   1 << 30,
+	"GB":  1e9,
+	"GIB": 1 << 30,
+	"T":   1 << 40,
+	"TB":  1e12,
+	"TIB": 1 << 40,
+}
+
+// ParseSize parses a byte size such as "512", "64KiB", "1.5GB" or "2G". Bare
+// K, M, G and T suffixes are binary units.
+func ParseSize(s string) (uint64, error) {
+	trimmed := strings.TrimSpace(s)
+	i := 0
+	for i < len(trimmed) && (trimmed[i] >= '0' && trimmed[i] <= '9' || trimmed[i] == '.') {
+		i++
+	}
+
+	number, err := strconv.ParseFloat(trimmed[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	unit, ok := sizeUnits[strings.ToUpper(strings.TrimSpace(trimmed[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit in '%s'", s)
+	}
+	return uint64(number * unit), nil
+}
+
+// cappedOutput holds the first max bytes of output in memory. Once output
+// exceeds it, everything is written to a spill file instead.
+type cappedOutput struct {
+	mu      sync.Mutex
+	max     uint64
+	logPath string
+	buf     bytes.Buffer
+	total   uint64
+	spill   *os.File
+	err     error
+}
+
+func newCappedOutput(limits Limits) *cappedOutput {
+	return &cappedOutput{max: limits.Output, logPath: limits.OutputLog}
+}
+
+func (c *cappedOutput) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.total += uint64(len(b))
+	if c.spill == nil && c.err == nil && c.total > c.max {
+		c.openSpill()
+	}
+
+	if c.spill != nil {
+		if _, err := c.spill.Write(b); err != nil && c.err == nil {
+			c.err = err
+		}
+	}
+	if room := int64(c.max) - int64(c.buf.Len()); room > 0 {
+		if int64(len(b)) > room {
+			c.buf.Write(b[:room])
+		} else {
+			c.buf.Write(b)
+		}
+	}
+	return len(b), nil
+}
+
+func (c *cappedOutput) openSpill() {
+	var err error
+	if c.logPath != "" {
+		c.spill, err = os.Create(c.logPath)
+	} else {
+		c.spill, err = os.CreateTemp("", "runner-output-*.log")
+	}
+	if err != nil {
+		c.err = err
+		return
+	}
+	c.logPath = c.spill.Name()
+	_, c.err = c.spill.Write(c.buf.Bytes())
+}
+
+// String returns the captured output with a note on where the rest went.
+func (c *cappedOutput) String() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.spill == nil && c.err == nil {
+		return c.buf.String()
+	}
+	if c.spill != nil {
+		c.spill.Close()
+	}
+	if c.err != nil {
+		return c.buf.String() + fmt.Sprintf("\n[output truncated after %d of %d bytes, spilling failed: %v]\n", c.max, c.total, c.err)
+	}
+	return c.buf.String() + fmt.Sprintf("\n[output truncated after %d of %d bytes, full output in %s]\n", c.max, c.total, c.logPath)
+}
@@ -0,0 +1,34 @@
+//go:build linux
+
+package runnerexec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// limitCommand prefixes command with the ulimit calls that apply the limits to
+// the shell, so they hold before the command runs and for every process it
+// starts. The shell exits with status 126 when a limit cannot be set.
+func limitCommand(command string, limits Limits) string {
+	if !limits.hasRlimits() {
+		return command
+	}
+
+	var ulimits []string
+	if limits.CPUSeconds != 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -t %d", limits.CPUSeconds))
+	}
+	if limits.AddressSpace != 0 {
+		// ulimit -v counts kilobytes
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -v %d", (limits.AddressSpace+1023)/1024))
+	}
+	if limits.NoFile != 0 {
+		ulimits = append(ulimits, fmt.Sprintf("ulimit -n %d", limits.NoFile))
+	}
+	if limits.NProc != 0 {
+		// dash names the process limit -p, bash and busybox -u
+		ulimits = append(ulimits, fmt.Sprintf("{ ulimit -u %d 2>/dev/null || ulimit -p %d; }", limits.NProc, limits.NProc))
+	}
+	return strings.Join(ulimits, " && ") + " || exit 126\n" + command
+}
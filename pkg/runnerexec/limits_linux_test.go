@@ -0,0 +1,51 @@
+//go:build linux
+
+package runnerexec
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRlimitsApplied(t *testing.T) {
+	result := <-Execute(LocalExecutor{}, Command{Exec: "ulimit -n", Limits: Limits{NoFile: 64}}, nil)
+	if result.Err != nil {
+		t.Fatalf("expected no error, got %v", result.Err)
+	}
+	if strings.TrimSpace(result.Output) != "64" {
+		t.Errorf("expected open files limit of 64, got %q", result.Output)
+	}
+}
+
+func TestRlimitsApplyToChildren(t *testing.T) {
+	limits := Limits{CPUSeconds: 30, AddressSpace: 1 << 30, NoFile: 64, NProc: 4096}
+	result := <-Execute(LocalExecutor{}, Command{Exec: "cat /proc/self/limits", Limits: limits}, nil)
+	if result.Err != nil {
+		t.Fatalf("expected no error, got %v", result.Err)
+	}
+
+	expected := []string{
+		`Max cpu time\s+30\s+30\s`,
+		`Max address space\s+1073741824\s+1073741824\s`,
+		`Max open files\s+64\s+64\s`,
+		`Max processes\s+4096\s+4096\s`,
+	}
+	for _, pattern := range expected {
+		if !regexp.MustCompile(pattern).MatchString(result.Output) {
+			t.Errorf("expected %q in the limits of the command, got %q", pattern, result.Output)
+		}
+	}
+}
+
+func TestCPULimitStopsRunawayCommand(t *testing.T) {
+	start := time.Now()
+	result := <-Execute(LocalExecutor{}, Command{Exec: "while :; do :; done", Limits: Limits{CPUSeconds: 1}}, nil)
+	if result.Err == nil {
+		t.Fatalf("expected runaway command to be stopped")
+	}
+	if time.Since(start) > 20*time.Second {
+		t.Errorf("expected command to be stopped after about a second of CPU time")
+	}
+}
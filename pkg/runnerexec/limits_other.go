@@ -0,0 +1,8 @@
+//go:build !linux
+
+package runnerexec
+
+// limitCommand returns command unchanged, resource limits are only applied on Linux.
+func limitCommand(command string, limits Limits) string {
+	return command
+}
@@ -0,0 +1,66 @@
+package runnerexec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected uint64
+		hasError bool
+	}{
+		{"512", 512, false},
+		{"10B", 10, false},
+		{"64KiB", 64 << 10, false},
+		{"2G", 2 << 30, false},
+		{"1.5GB", 1500000000, false},
+		{" 20 gb ", 20000000000, false},
+		{"10XB", 0, true},
+		{"lots", 0, true},
+	}
+
+	for _, test := range tests {
+		size, err := ParseSize(test.input)
+		if (err != nil) != test.hasError {
+			t.Errorf("%q: expected error %v, got %v", test.input, test.hasError, err)
+			continue
+		}
+		if size != test.expected {
+			t.Errorf("%q: expected %d, got %d", test.input, test.expected, size)
+		}
+	}
+}
+
+func TestOutputLimitSpillsToLog(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "output.log")
+
+	result := <-Execute(LocalExecutor{}, Command{
+		Exec:   "printf 'abcdefghij0123456789'",
+		Limits: Limits{Output: 10, OutputLog: logFile},
+	}, nil)
+	if result.Err != nil {
+		t.Fatalf("expected no error, got %v", result.Err)
+	}
+	if !strings.HasPrefix(result.Output, "abcdefghij\n[output truncated after 10 of 20 bytes, full output in "+logFile) {
+		t.Errorf("unexpected truncated output %q", result.Output)
+	}
+
+	spilled, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("expected spilled output, got %v", err)
+	}
+	if string(spilled) != "abcdefghij0123456789" {
+		t.Errorf("expected full output in log file, got %q", spilled)
+	}
+}
+
+func TestOutputLimitNotReached(t *testing.T) {
+	result := <-Execute(LocalExecutor{}, Command{Exec: "echo short", Limits: Limits{Output: 1024}}, nil)
+	if result.Output != "short\n" {
+		t.Errorf("expected output %q, got %q", "short\n", result.Output)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package runnerexec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in a process group of its own, so that
+// killing it also kills the commands the shell started.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// signalProcessGroup sends SIGTERM, or SIGKILL when kill is set, to the
+// process group led by pid.
+func signalProcessGroup(pid int, kill bool) error {
+	sig := syscall.SIGTERM
+	if kill {
+		sig = syscall.SIGKILL
+	}
+	return syscall.Kill(-pid, sig)
+}
+
+// processGroupAlive reports whether any process of the group led by pid is still running.
+func processGroupAlive(pid int) bool {
+	return syscall.Kill(-pid, 0) == nil
+}
@@ -0,0 +1,26 @@
+//go:build windows
+
+package runnerexec
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup is a no-op, process groups are only used on Unix.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup kills the shell of the command, Windows has no SIGTERM
+// to send first.
+func signalProcessGroup(pid int, kill bool) error {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Kill()
+}
+
+// processGroupAlive reports false, the shell is killed right away.
+func processGroupAlive(pid int) bool {
+	return false
+}
@@ -1,7 +1,6 @@
 package runnerexec
 
 import (
-	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -18,7 +17,11 @@ type CommandResult struct {
 	Err      error
 }
 
+// ShellSession is the default local Executor. Commands run in their own
+// `sh -c` invocation alongside a long-lived shell.
 type ShellSession struct {
+	LocalExecutor
+
 	cmd    *exec.Cmd
 	stdin  io.WriteCloser
 	stdout io.ReadCloser
@@ -62,37 +65,16 @@ func (s *ShellSession) Close() error {
 
 // ExecuteCommand runs a shell command and returns its output, exit code, and error if any.
 func (s *ShellSession) ExecuteCommand(execCmd string) <-chan CommandResult {
-	resultChan := make(chan CommandResult)
-
-	go func() {
-		defer close(resultChan)
-
-		var outbuf, errbuf bytes.Buffer
-
-		// Use a new command to execute the input command within the session
-		cmd := exec.Command("sh", "-c", execCmd)
-		cmd.Stdout = &outbuf
-		cmd.Stderr = &errbuf
-
-		err := cmd.Run()
-		output := outbuf.String() + errbuf.String()
-		exitCode := 0
-
-		if err != nil {
-			if exitError, ok := err.(*exec.ExitError); ok {
-				exitCode = exitError.ExitCode()
-			}
-		}
-
-		resultChan <- CommandResult{Output: output, ExitCode: exitCode, Err: err}
-	}()
-
-	return resultChan
+	return Execute(s, Command{Exec: execCmd}, nil)
 }
 
 // Which searches for an executable in the directories specified by the PATH environment variable.
 func Which(executable string) (string, error) {
-	pathEnv := os.Getenv("PATH")
+	return WhichPath(executable, os.Getenv("PATH"))
+}
+
+// WhichPath searches for an executable in the directories of the given PATH value.
+func WhichPath(executable string, pathEnv string) (string, error) {
 	pathSeparator := string(os.PathListSeparator)
 	paths := strings.Split(pathEnv, pathSeparator)
 
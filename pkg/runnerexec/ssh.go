@@ -0,0 +1,294 @@
+package runnerexec
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHConfig holds the connection settings shared by all remote hosts.
+type SSHConfig struct {
+	// User is used for targets that do not name one. Defaults to the local user.
+	User string `mapstructure:"user"`
+	// Port is used for targets that do not name one. Defaults to 22.
+	Port int `mapstructure:"port"`
+	// Key is a private key file. The ssh-agent behind SSH_AUTH_SOCK is used as well when available.
+	Key string `mapstructure:"key"`
+	// KnownHosts is the known_hosts file used to verify host keys. Defaults to ~/.ssh/known_hosts.
+	KnownHosts string `mapstructure:"known_hosts"`
+	// InsecureIgnoreHostKey disables host key verification.
+	InsecureIgnoreHostKey bool `mapstructure:"insecure_ignore_host_key"`
+	// Timeout limits how long establishing a connection may take.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// SSHExecutor runs commands on a remote host over SSH. The connection is
+// established on the first command and reused until Close is called. Only the
+// output limit of a command is applied on the remote host.
+type SSHExecutor struct {
+	// Addr is the host:port the executor connects to.
+	Addr string
+	// Target is the host as it was written in the workflow.
+	Target string
+
+	config *ssh.ClientConfig
+	// agentSock is the ssh-agent socket offered during the handshake, if any.
+	agentSock string
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// NewSSHExecutor prepares an executor for a `[user@]host[:port]` target.
+func NewSSHExecutor(target string, cfg SSHConfig) (*SSHExecutor, error) {
+	username, addr, err := parseSSHTarget(target, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	auth, agentSock, err := sshAuthMethods(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	hostKeyCallback, err := sshHostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 30 * time.Second
+	}
+
+	return &SSHExecutor{
+		Addr:   addr,
+		Target: target,
+		config: &ssh.ClientConfig{
+			User:            username,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         timeout,
+		},
+		agentSock: agentSock,
+	}, nil
+}
+
+func parseSSHTarget(target string, cfg SSHConfig) (string, string, error) {
+	username := cfg.User
+	host := target
+	if at := strings.LastIndex(target, "@"); at != -1 {
+		username, host = target[:at], target[at+1:]
+	}
+	if username == "" {
+		if u, err := user.Current(); err == nil {
+			username = u.Username
+		}
+	}
+
+	port := strconv.Itoa(22)
+	if cfg.Port != 0 {
+		port = strconv.Itoa(cfg.Port)
+	}
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+	if host == "" {
+		return "", "", fmt.Errorf("invalid ssh target '%s'", target)
+	}
+
+	return username, net.JoinHostPort(host, port), nil
+}
+
+// sshAuthMethods returns the key authentication of cfg, and the socket of the
+// ssh-agent when one is listening. The agent is connected to for each
+// handshake only, see connect.
+func sshAuthMethods(cfg SSHConfig) ([]ssh.AuthMethod, string, error) {
+	var methods []ssh.AuthMethod
+
+	if cfg.Key != "" {
+		key, err := os.ReadFile(expandHome(cfg.Key))
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to read ssh key: %w", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to parse ssh key '%s': %w", cfg.Key, err)
+		}
+		methods = append(methods, ssh.PublicKeys(signer))
+	}
+
+	var agentSock string
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			conn.Close()
+			agentSock = sock
+		}
+	}
+
+	if len(methods) == 0 && agentSock == "" {
+		return nil, "", fmt.Errorf("no ssh key configured and no ssh-agent available")
+	}
+	return methods, agentSock, nil
+}
+
+func sshHostKeyCallback(cfg SSHConfig) (ssh.HostKeyCallback, error) {
+	if cfg.InsecureIgnoreHostKey {
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+
+	knownHostsFile := cfg.KnownHosts
+	if knownHostsFile == "" {
+		knownHostsFile = "~/.ssh/known_hosts"
+	}
+	callback, err := knownhosts.New(expandHome(knownHostsFile))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load known hosts: %w", err)
+	}
+	return callback, nil
+}
+
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+func (e *SSHExecutor) connect() (*ssh.Client, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.client != nil {
+		return e.client, nil
+	}
+
+	config := *e.config
+	if e.agentSock != "" {
+		// The agent signs during the handshake only, so its connection ends with it
+		if conn, err := net.Dial("unix", e.agentSock); err == nil {
+			defer conn.Close()
+			config.Auth = append(config.Auth[:len(config.Auth):len(config.Auth)], ssh.PublicKeysCallback(agent.NewClient(conn).Signers))
+		}
+	}
+
+	client, err := ssh.Dial("tcp", e.Addr, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to '%s': %w", e.Target, err)
+	}
+	e.client = client
+	return client, nil
+}
+
+// Start runs the command in `sh -c` on the remote host.
+func (e *SSHExecutor) Start(command Command, stream io.Writer) (Process, error) {
+	client, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ssh session on '%s': %w", e.Target, err)
+	}
+
+	proc := &sshProcess{session: session}
+	var stdout, stderr io.Writer = &proc.outbuf, &proc.errbuf
+	if command.Limits.Output > 0 {
+		proc.capped = newCappedOutput(command.Limits)
+		stdout, stderr = proc.capped, proc.capped
+	}
+	if stream != nil {
+		stream = &syncWriter{w: stream}
+		stdout, stderr = io.MultiWriter(stdout, stream), io.MultiWriter(stderr, stream)
+	}
+	session.Stdout, session.Stderr = stdout, stderr
+
+	if err := session.Start(RemoteCommandLine(command)); err != nil {
+		session.Close()
+		return nil, err
+	}
+	return proc, nil
+}
+
+// Close disconnects from the remote host.
+func (e *SSHExecutor) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.client == nil {
+		return nil
+	}
+	err := e.client.Close()
+	e.client = nil
+	return err
+}
+
+// RemoteCommandLine renders a command as a single shell line that applies its
+// working directory and environment before running it with `sh -c`.
+func RemoteCommandLine(command Command) string {
+	var line strings.Builder
+	if command.Dir != "" {
+		line.WriteString("cd " + ShellQuote(command.Dir) + " && ")
+	}
+	if len(command.Env) > 0 {
+		line.WriteString("env")
+		for _, kv := range command.Env {
+			line.WriteString(" " + ShellQuote(kv))
+		}
+		line.WriteString(" ")
+	}
+	line.WriteString("sh -c " + ShellQuote(command.Exec))
+	return line.String()
+}
+
+// ShellQuote quotes s for use as a single POSIX shell word.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type sshProcess struct {
+	session        *ssh.Session
+	outbuf, errbuf bytes.Buffer
+	capped         *cappedOutput
+}
+
+func (p *sshProcess) Wait() CommandResult {
+	err := p.session.Wait()
+	p.session.Close()
+
+	output := p.outbuf.String() + p.errbuf.String()
+	if p.capped != nil {
+		output = p.capped.String()
+	}
+	exitCode := 0
+
+	if err != nil {
+		exitCode = -1
+		if exitError, ok := err.(*ssh.ExitError); ok {
+			exitCode = exitError.ExitStatus()
+		}
+	}
+
+	return CommandResult{Output: output, ExitCode: exitCode, Err: err}
+}
+
+func (p *sshProcess) Kill() error {
+	// Not every server honours signals, closing the session ends the command either way.
+	p.session.Signal(ssh.SIGKILL)
+	return p.session.Close()
+}
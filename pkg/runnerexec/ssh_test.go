@@ -0,0 +1,279 @@
+package runnerexec
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// startTestSSHServer runs an SSH server that executes "exec" requests in a
+// local shell, standing in for a remote host.
+func startTestSSHServer(t *testing.T, authorized ssh.PublicKey) string {
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate host key: %v", err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatalf("failed to create host signer: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(key.Marshal(), authorized.Marshal()) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("unknown public key")
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveTestSSHConn(conn, config)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func serveTestSSHConn(conn net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unsupported channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+
+		go func() {
+			defer channel.Close()
+			for req := range requests {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+
+				var payload struct{ Command string }
+				ssh.Unmarshal(req.Payload, &payload)
+				req.Reply(true, nil)
+
+				cmd := exec.Command("sh", "-c", payload.Command)
+				cmd.Stdout = channel
+				cmd.Stderr = channel.Stderr()
+
+				status := 0
+				if err := cmd.Run(); err != nil {
+					status = 127
+					if exitError, ok := err.(*exec.ExitError); ok {
+						status = exitError.ExitCode()
+					}
+				}
+				channel.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{uint32(status)}))
+				return
+			}
+		}()
+	}
+}
+
+// writeTestClientKey generates a client key pair and writes the private key to a file.
+func writeTestClientKey(t *testing.T) (string, ssh.PublicKey) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKey(privateKey, "")
+	if err != nil {
+		t.Fatalf("failed to marshal client key: %v", err)
+	}
+
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("failed to write client key: %v", err)
+	}
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("failed to convert client key: %v", err)
+	}
+	return keyFile, sshPublicKey
+}
+
+func TestSSHExecutor(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	keyFile, publicKey := writeTestClientKey(t)
+	addr := startTestSSHServer(t, publicKey)
+
+	executor, err := NewSSHExecutor("tester@"+addr, SSHConfig{Key: keyFile, InsecureIgnoreHostKey: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer executor.Close()
+
+	t.Run("Streams output", func(t *testing.T) {
+		var stream bytes.Buffer
+		proc, err := executor.Start(Command{Exec: "echo remote"}, &stream)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		result := proc.Wait()
+		if result.Err != nil || result.Output != "remote\n" {
+			t.Errorf("expected output %q, got %+v", "remote\n", result)
+		}
+		if stream.String() != "remote\n" {
+			t.Errorf("expected streamed output %q, got %q", "remote\n", stream.String())
+		}
+	})
+
+	t.Run("Reports exit status", func(t *testing.T) {
+		result := <-Execute(executor, Command{Exec: "exit 3"}, nil)
+		if result.Err == nil || result.ExitCode != 3 {
+			t.Errorf("expected exit code 3, got %+v", result)
+		}
+	})
+
+	t.Run("Applies env and dir", func(t *testing.T) {
+		dir := t.TempDir()
+		result := <-Execute(executor, Command{Exec: "echo $GREETING; pwd", Env: []string{"GREETING=it's me"}, Dir: dir}, nil)
+		if result.Err != nil {
+			t.Fatalf("expected no error, got %v", result.Err)
+		}
+		if !strings.HasPrefix(result.Output, "it's me\n") || !strings.Contains(result.Output, dir) {
+			t.Errorf("expected env and working directory in output, got %q", result.Output)
+		}
+	})
+}
+
+func TestSSHExecutorClosesAgentConnection(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %v", err)
+	}
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: privateKey}); err != nil {
+		t.Fatalf("failed to add key to agent: %v", err)
+	}
+
+	dir, err := os.MkdirTemp("", "agent")
+	if err != nil {
+		t.Fatalf("failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	listener, err := net.Listen("unix", filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatalf("failed to listen for agent: %v", err)
+	}
+	defer listener.Close()
+
+	var open atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			open.Add(1)
+			go func() {
+				defer open.Add(-1)
+				agent.ServeAgent(keyring, conn)
+			}()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", listener.Addr().String())
+
+	sshPublicKey, err := ssh.NewPublicKey(publicKey)
+	if err != nil {
+		t.Fatalf("failed to convert client key: %v", err)
+	}
+	addr := startTestSSHServer(t, sshPublicKey)
+
+	executor, err := NewSSHExecutor("tester@"+addr, SSHConfig{InsecureIgnoreHostKey: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer executor.Close()
+
+	if result := <-Execute(executor, Command{Exec: "echo agent"}, nil); result.Err != nil || result.Output != "agent\n" {
+		t.Fatalf("expected output %q, got %+v", "agent\n", result)
+	}
+	for deadline := time.Now().Add(5 * time.Second); open.Load() != 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the agent connection to be closed, %d still open", open.Load())
+		}
+	}
+}
+
+func TestSSHExecutorRejectsUnknownKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	keyFile, _ := writeTestClientKey(t)
+	_, otherKey := writeTestClientKey(t)
+	addr := startTestSSHServer(t, otherKey)
+
+	executor, err := NewSSHExecutor(addr, SSHConfig{User: "tester", Key: keyFile, InsecureIgnoreHostKey: true})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	if _, err := executor.Start(Command{Exec: "true"}, nil); err == nil {
+		t.Errorf("expected authentication error, got none")
+	}
+}
+
+func TestParseSSHTarget(t *testing.T) {
+	tests := []struct {
+		target string
+		cfg    SSHConfig
+		user   string
+		addr   string
+	}{
+		{"deploy@web1", SSHConfig{}, "deploy", "web1:22"},
+		{"deploy@web1:2222", SSHConfig{}, "deploy", "web1:2222"},
+		{"web1", SSHConfig{User: "ops", Port: 2200}, "ops", "web1:2200"},
+		{"web1:2222", SSHConfig{User: "ops", Port: 2200}, "ops", "web1:2222"},
+	}
+
+	for _, test := range tests {
+		user, addr, err := parseSSHTarget(test.target, test.cfg)
+		if err != nil {
+			t.Errorf("expected no error for %q, got %v", test.target, err)
+			continue
+		}
+		if user != test.user || addr != test.addr {
+			t.Errorf("expected %s at %s for %q, got %s at %s", test.user, test.addr, test.target, user, addr)
+		}
+	}
+}